@@ -6,117 +6,732 @@ import (
 	"io"
 	"os"
 	"path/filepath"
-
-	"cuelang.org/go/cue"
-	"cuelang.org/go/cue/cuecontext"
+	"reflect"
+	"slices"
+	"strings"
 
 	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/lexer"
+	"github.com/goccy/go-yaml/parser"
+	"github.com/goccy/go-yaml/token"
+	"go.uber.org/zap"
+)
+
+// overlayMetaFile is the optional file inside an overlay directory that
+// declares which overlays it extends. It is never merged as data.
+const overlayMetaFile = ".overlay.yaml"
+
+// overlayMeta is the content of an overlayMetaFile.
+type overlayMeta struct {
+	// Extends lists the parent overlays, relative to the overlay directory.
+	// Parents are applied before the overlay itself, in the given order.
+	Extends []string `yaml:"extends"`
+}
+
+// listMergeStrategy controls how an overlay list is combined with the list
+// it overrides.
+type listMergeStrategy string
+
+const (
+	listReplace listMergeStrategy = "replace"
+	listAppend  listMergeStrategy = "append"
+	listPrepend listMergeStrategy = "prepend"
+	listMerge   listMergeStrategy = "merge"
 )
 
+// defaultListMergeKey identifies list items for the merge strategy when no
+// key is given.
+const defaultListMergeKey = "name"
+
+// listMergeRule selects the merge strategy for the lists at a key path. Path
+// segments are separated by dots, "*" matches any single segment.
+type listMergeRule struct {
+	Path     string            `mapstructure:"path"`
+	Strategy listMergeStrategy `mapstructure:"strategy"`
+	// Key is the field identifying list items for the merge strategy.
+	Key string `mapstructure:"key"`
+}
+
+// listMergeRules are the project wide list merge rules, see initConfig. Lists
+// without a rule or a merge tag replace the list they override.
+var listMergeRules []listMergeRule
+
+// deleteTag removes the tagged key and everything below it from the merged
+// data. A plain null only sets the key to null.
+const deleteTag = "!delete"
+
+// deleteMarker is the decoded value of a key tagged with !delete. It only
+// lives until the key has been merged.
+type deleteMarker struct{}
+
+// taggedList is an overlay list carrying a merge tag such as !append or
+// !merge:name. It only lives until the list has been merged.
+type taggedList struct {
+	rule  listMergeRule
+	items []any
+}
+
+// validate checks the strategy of the rule and fills in the default key.
+func (r *listMergeRule) validate() error {
+	switch r.Strategy {
+	case listReplace, listAppend, listPrepend:
+	case listMerge:
+		if len(r.Key) == 0 {
+			r.Key = defaultListMergeKey
+		}
+	default:
+		return fmt.Errorf("unknown list merge strategy %q for %q, available values [replace, append, prepend, merge]", r.Strategy, r.Path)
+	}
+	return nil
+}
+
+// matches reports whether the rule applies to the given key path.
+func (r listMergeRule) matches(path []string) bool {
+	segments := strings.Split(r.Path, ".")
+	if len(segments) != len(path) {
+		return false
+	}
+	for i, segment := range segments {
+		if segment != "*" && segment != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// parseListMergeTag parses a YAML merge tag: !replace, !append, !prepend,
+// !merge or !merge:<key>.
+func parseListMergeTag(tag string) (listMergeRule, bool) {
+	strategy, key, _ := strings.Cut(strings.TrimPrefix(tag, "!"), ":")
+	rule := listMergeRule{Strategy: listMergeStrategy(strategy), Key: key}
+	if rule.validate() != nil {
+		return rule, false
+	}
+	return rule, true
+}
+
+// asMap returns value as a map if it is one.
+func asMap(value any) (map[string]any, bool) {
+	switch m := value.(type) {
+	case map[string]any:
+		return m, true
+	case Data:
+		return m, true
+	}
+	return nil, false
+}
+
 func mergeData(base, overlay Data) Data {
+	return mergeDataAt(base, overlay, nil)
+}
+
+// mergeDataAt merges overlay into base. path is the key path of base in the
+// merged tree and is used to look up list merge rules.
+func mergeDataAt(base, overlay Data, path []string) Data {
 	for key, value := range overlay {
+		if _, ok := value.(deleteMarker); ok {
+			delete(base, key)
+			continue
+		}
+		keyPath := append(slices.Clip(path), key)
 		if baseValue, exists := base[key]; exists {
 			// If both values are maps, merge them recursively
-			if baseMap, ok := baseValue.(map[string]any); ok {
-				if overlayMap, ok := value.(map[string]any); ok {
-					base[key] = mergeData(baseMap, overlayMap)
+			if baseMap, ok := asMap(baseValue); ok {
+				if overlayMap, ok := asMap(value); ok {
+					base[key] = mergeDataAt(baseMap, overlayMap, keyPath)
+					continue
+				}
+			}
+			// If both values are lists, combine them by their merge strategy
+			if baseList, ok := baseValue.([]any); ok {
+				if rule, items, ok := overlayListRule(value, keyPath); ok {
+					base[key] = mergeLists(baseList, items, rule, keyPath)
 					continue
 				}
 			}
 		}
 		// Otherwise, overlay value takes precedence
-		base[key] = value
+		base[key] = stripMergeTags(value)
 	}
 	return base
 }
 
-func validateData(data Data) error {
-	ctx := cuecontext.New()
-	schema := ctx.CompileString(schemaFile).LookupPath(cue.ParsePath("#Schema"))
+// overlayListRule returns the merge rule and the items of an overlay list,
+// preferring a merge tag over the project rules.
+func overlayListRule(value any, path []string) (listMergeRule, []any, bool) {
+	switch list := value.(type) {
+	case taggedList:
+		return list.rule, list.items, true
+	case []any:
+		for _, rule := range listMergeRules {
+			if rule.matches(path) {
+				return rule, list, true
+			}
+		}
+	}
+	return listMergeRule{}, nil, false
+}
+
+// mergeLists combines base and overlay list items according to rule.
+func mergeLists(base, overlay []any, rule listMergeRule, path []string) []any {
+	for i, item := range overlay {
+		if rule.Strategy != listMerge {
+			overlay[i] = stripMergeTags(item)
+		}
+	}
 
-	dataAsCue := ctx.Encode(data)
+	switch rule.Strategy {
+	case listAppend:
+		return append(slices.Clip(base), overlay...)
+	case listPrepend:
+		return append(slices.Clip(overlay), base...)
+	case listMerge:
+		merged := slices.Clip(base)
+		for _, item := range overlay {
+			index := slices.IndexFunc(merged, func(baseItem any) bool {
+				return sameListMergeKey(baseItem, item, rule.Key)
+			})
+			if index < 0 {
+				merged = append(merged, stripMergeTags(item))
+				continue
+			}
+			baseItem, _ := asMap(merged[index])
+			overlayItem, _ := asMap(item)
+			merged[index] = mergeDataAt(baseItem, overlayItem, append(slices.Clip(path), fmt.Sprint(overlayItem[rule.Key])))
+		}
+		return merged
+	}
+	return overlay
+}
 
-	unified := schema.Unify(dataAsCue)
-	err := unified.Validate()
+// stripMergeTagsInMap applies stripMergeTags to every value of m.
+func stripMergeTagsInMap(m map[string]any) {
+	for key, item := range m {
+		if _, ok := item.(deleteMarker); ok {
+			delete(m, key)
+			continue
+		}
+		m[key] = stripMergeTags(item)
+	}
+}
+
+// sameListMergeKey reports whether a and b are maps with the same value for
+// key, see sameKeyValue.
+func sameListMergeKey(a, b any, key string) bool {
+	aMap, ok := asMap(a)
+	if !ok {
+		return false
+	}
+	bMap, ok := asMap(b)
+	if !ok {
+		return false
+	}
+	aKey, ok := aMap[key]
+	if !ok {
+		return false
+	}
+	bKey, ok := bMap[key]
+	return ok && sameKeyValue(aKey, bKey)
+}
+
+// sameKeyValue reports whether a and b are the same decoded value. Numbers
+// compare by value, as the formats decode them to different types, while
+// values of different kinds never match, so 1 and "1" are different keys.
+func sameKeyValue(a, b any) bool {
+	if isNumber(a) && isNumber(b) {
+		return fmt.Sprint(a) == fmt.Sprint(b)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// isNumber reports whether v is a decoded number.
+func isNumber(v any) bool {
+	switch v.(type) {
+	case int, int64, uint64, float64:
+		return true
+	}
+	return false
+}
+
+// stripMergeTags replaces tagged lists below value by their items and drops
+// deleted keys, for values that have nothing to be merged with.
+func stripMergeTags(value any) any {
+	switch v := value.(type) {
+	case taggedList:
+		return stripMergeTags(v.items)
+	case map[string]any:
+		stripMergeTagsInMap(v)
+	case Data:
+		stripMergeTagsInMap(v)
+	case []any:
+		for i, item := range v {
+			v[i] = stripMergeTags(item)
+		}
+	}
+	return value
+}
+
+// validateData validates data against the schema at schemaPath, see
+// newValidator, and returns the data templates should see. Violations are
+// returned as a *validationError.
+func validateData(data Data) (Data, error) {
+	return newValidator(schemaPath).validate(data)
+}
+
+// checkData validates data, merged from the base and the given overlays,
+// against the schema and the policy rules. Policy warnings are returned along
+// with the validated data. Schema violations and policy errors fail the check
+// and are returned as a *validationError that also holds the warnings.
+func checkData(data Data, overlays []string) (Data, []validationIssue, error) {
+	layers, err := resolveOverlayLayers(overlays)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
-	return nil
+	findings := checkPolicies(data, policyRules, layers)
+
+	validated, err := validateData(data)
+	var validationErr *validationError
+	if err != nil && !errors.As(err, &validationErr) {
+		return nil, nil, err
+	}
+
+	var issues []validationIssue
+	if validationErr != nil {
+		issues = validationErr.Issues
+	}
+	issues = append(issues, findings...)
+	if countErrors(issues) > 0 {
+		return nil, nil, &validationError{Issues: issues}
+	}
+	return validated, issues, nil
 }
 
-func loadAndMergeYAMLFiles(baseDirPath string, overlayDirPath string) (Data, error) {
-	mergedData := make(Data)
-	var errs error
-	// Walk through the baseDir data directory
-	errWalkBase := filepath.Walk(baseDirPath, func(path string, info os.FileInfo, err error) error {
+// validateDecryptedData validates the decrypted data against the schema at
+// secretSchemaPath. encrypted is the same data before decryption, used to
+// tell which values are secrets: they are redacted from the returned error.
+func validateDecryptedData(encrypted, decrypted Data) (Data, error) {
+	validated, err := newValidator(secretSchemaPath).validate(decrypted)
+	if err != nil {
+		return nil, redactError(err, decryptedValues(encrypted, decrypted))
+	}
+	return validated, nil
+}
+
+// readOverlayMeta reads the overlayMetaFile of an overlay directory. A
+// directory without one extends nothing.
+func readOverlayMeta(dirPath string) (overlayMeta, error) {
+	var meta overlayMeta
+
+	content, err := os.ReadFile(filepath.Join(dirPath, overlayMetaFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return meta, nil
+	}
+	if err != nil {
+		return meta, fmt.Errorf("error reading overlay metadata of %s: %v", dirPath, err)
+	}
+
+	if err := yaml.Unmarshal(content, &meta); err != nil {
+		return meta, fmt.Errorf("error parsing overlay metadata of %s: %v", dirPath, err)
+	}
+	return meta, nil
+}
+
+// discoverOverlays returns every overlay directory below dirPath, sorted by
+// name. Hidden directories are skipped.
+func discoverOverlays(dirPath string) ([]string, error) {
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading overlays from %s: %v", dirPath, err)
+	}
+
+	var overlays []string
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		overlays = append(overlays, filepath.Join(dirPath, entry.Name()))
+	}
+	return overlays, nil
+}
+
+// resolveOverlayLayers expands the given overlay directories into the ordered
+// list of layers to apply on top of the base. Every overlay is preceded by the
+// overlays it extends, and each directory is only applied once.
+func resolveOverlayLayers(overlayDirPaths []string) ([]string, error) {
+	var layers []string
+	applied := make(map[string]bool)
+	visiting := make(map[string]bool)
+
+	var visit func(dirPath string, chain []string) error
+	visit = func(dirPath string, chain []string) error {
+		dirPath = filepath.Clean(dirPath)
+		if applied[dirPath] {
+			return nil
+		}
+		if visiting[dirPath] {
+			return fmt.Errorf("overlay cycle detected: %s", strings.Join(append(chain, dirPath), " -> "))
+		}
+
+		info, err := os.Stat(dirPath)
+		if err != nil || !info.IsDir() {
+			if len(chain) > 0 {
+				return fmt.Errorf("overlay %s extends %s, which is not a directory", chain[len(chain)-1], dirPath)
+			}
+			return fmt.Errorf("overlay %s is not a directory", dirPath)
+		}
+
+		meta, err := readOverlayMeta(dirPath)
 		if err != nil {
 			return err
 		}
 
-		// Skip if not a YAML file
-		if !info.IsDir() && (filepath.Ext(path) == ".yaml" || filepath.Ext(path) == ".yml") {
-			// Read the YAML file
-			f, err := os.Open(path)
-			if err != nil {
-				return fmt.Errorf("error opening file %s: %v", path, err)
+		visiting[dirPath] = true
+		for _, parent := range meta.Extends {
+			if !filepath.IsAbs(parent) {
+				parent = filepath.Join(dirPath, parent)
 			}
-			content, err := io.ReadAll(f)
-			if err != nil {
-				return fmt.Errorf("error reading file %s: %v", path, err)
+			if err := visit(parent, append(chain, dirPath)); err != nil {
+				return err
 			}
+		}
+		visiting[dirPath] = false
 
-			// Parse YAML content
-			var data Data
-			if err := yaml.Unmarshal(content, &data); err != nil {
-				return fmt.Errorf("error parsing YAML from %s: %v", path, err)
-			}
+		applied[dirPath] = true
+		layers = append(layers, dirPath)
+		return nil
+	}
 
-			// Merge with existing data
-			mergedData = mergeData(mergedData, data)
+	for _, dirPath := range overlayDirPaths {
+		if err := visit(dirPath, nil); err != nil {
+			return nil, err
 		}
-		return nil
-	})
+	}
+	return layers, nil
+}
 
-	if errWalkBase != nil {
-		errs = errors.Join(errWalkBase)
+// decodeYAML decodes every document of a YAML data file, in order, and keeps
+// the merge tags of their values, which plain unmarshalling drops. Errors name
+// the document they occurred in, counting from 1.
+func decodeYAML(content []byte) ([]dataDocument, error) {
+	file, err := parser.ParseBytes(content, 0)
+	if err != nil {
+		if line, ok := bareFlowDelete(content); ok {
+			return nil, fmt.Errorf("document %d: line %d: %s needs a value in flow style, write %s ~ or use block style", yamlDocumentAt(content, line), line, deleteTag, deleteTag)
+		}
+		var syntaxErr *yaml.SyntaxError
+		if errors.As(err, &syntaxErr) && syntaxErr.Token != nil {
+			return nil, fmt.Errorf("document %d: %v", yamlDocumentAt(content, syntaxErr.Token.Position.Line), err)
+		}
+		return nil, err
 	}
 
-	errWalkOverlays := filepath.Walk(overlayDirPath, func(path string, info os.FileInfo, err error) error {
+	var documents []dataDocument
+	for i, doc := range file.Docs {
+		// Skip empty documents, e.g. after a trailing "---"
+		if doc.Body == nil {
+			continue
+		}
+
+		detachBareDeleteValues(doc.Body, nil)
+
+		var data Data
+		if err := yaml.NodeToValue(doc.Body, &data); err != nil {
+			return nil, fmt.Errorf("document %d: %v", i+1, err)
+		}
+		if data == nil {
+			continue
+		}
+
+		tagged, err := applyMergeTags(data, doc.Body)
 		if err != nil {
-			return err
+			return nil, fmt.Errorf("document %d: %v", i+1, err)
+		}
+		data, _ = tagged.(Data)
+
+		lines := make(map[string]int)
+		yamlLines(doc.Body, nil, lines)
+		documents = append(documents, dataDocument{data: data, lines: lines})
+	}
+	return documents, nil
+}
+
+// bareFlowDelete returns the line of the first !delete tag without a value in
+// a flow mapping or list, which the parser can not read.
+func bareFlowDelete(content []byte) (int, bool) {
+	tokens := lexer.Tokenize(string(content))
+	for i, tk := range tokens {
+		switch {
+		// The lexer reads e.g. "!delete}" as invalid tag
+		case tk.Type == token.InvalidType && strings.HasPrefix(strings.TrimSpace(tk.Value), deleteTag):
+			return tk.Position.Line, true
+		case tk.Type == token.TagType && tk.Value == deleteTag && i+1 < len(tokens):
+			switch tokens[i+1].Type {
+			case token.CollectEntryType, token.MappingEndType, token.SequenceEndType:
+				return tk.Position.Line, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// yamlDocumentAt returns the number of the YAML document containing line,
+// counting from 1, based on the "---" separators before it.
+func yamlDocumentAt(content []byte, line int) int {
+	document := 1
+	seenContent := false
+	for i, text := range strings.Split(string(content), "\n") {
+		if i+1 >= line {
+			break
+		}
+		trimmed := strings.TrimSpace(text)
+		if strings.HasPrefix(text, "---") && seenContent {
+			document++
+		}
+		// A separator before any content starts the first document
+		if strings.HasPrefix(text, "---") || (len(trimmed) > 0 && !strings.HasPrefix(trimmed, "#") && !strings.HasPrefix(trimmed, "%")) {
+			seenContent = true
+		}
+	}
+	return document
+}
+
+// detachBareDeleteValues gives every !delete tag below node that is written
+// without a value a null value. The parser reads whatever follows such a tag
+// as its value, such as the next keys of the enclosing mapping, so these move
+// back to the enclosing mapping or list at their column. collections are the
+// mappings and lists enclosing node, innermost last.
+func detachBareDeleteValues(node ast.Node, collections []ast.Node) {
+	switch n := node.(type) {
+	case *ast.TagNode:
+		if n.Start.Value == deleteTag {
+			detachBareDeleteValue(n, collections)
+			return
+		}
+		detachBareDeleteValues(n.Value, collections)
+	case *ast.AnchorNode:
+		detachBareDeleteValues(n.Value, collections)
+	case *ast.MappingValueNode:
+		detachBareDeleteValues(n.Value, collections)
+	case *ast.MappingNode:
+		collections = append(slices.Clip(collections), n)
+		// Keys moved to n are appended and visited in turn
+		for i := 0; i < len(n.Values); i++ {
+			detachBareDeleteValues(n.Values[i], collections)
+		}
+	case *ast.SequenceNode:
+		collections = append(slices.Clip(collections), n)
+		for i := 0; i < len(n.Values); i++ {
+			detachBareDeleteValues(n.Values[i], collections)
+		}
+	}
+}
+
+// detachBareDeleteValue moves the value of a !delete tag starting on a later
+// line to the innermost enclosing collection of the same kind and column, and
+// replaces it with null. A value indented deeper than its siblings is the
+// tagged value and stays.
+func detachBareDeleteValue(tag *ast.TagNode, collections []ast.Node) {
+	null := ast.Null(token.New("null", "null", tag.Start.Position))
+	if tag.Value == nil {
+		tag.Value = null
+		return
+	}
+	if tag.Value.GetToken().Position.Line == tag.Start.Position.Line {
+		return
+	}
+
+	column, ok := collectionColumn(tag.Value)
+	if !ok {
+		return
+	}
+	for i := len(collections) - 1; i >= 0; i-- {
+		if c, ok := collectionColumn(collections[i]); !ok || c != column {
+			continue
+		}
+		switch target := collections[i].(type) {
+		case *ast.MappingNode:
+			if value, ok := tag.Value.(*ast.MappingNode); ok {
+				target.Values = append(target.Values, value.Values...)
+				tag.Value = null
+				return
+			}
+		case *ast.SequenceNode:
+			if value, ok := tag.Value.(*ast.SequenceNode); ok {
+				target.Merge(value)
+				tag.Value = null
+				return
+			}
 		}
+	}
+}
 
-		// Skip if not a YAML file
-		if !info.IsDir() && (filepath.Ext(path) == ".yaml" || filepath.Ext(path) == ".yml") {
-			// Read the YAML file
-			f, err := os.Open(path)
+// collectionColumn returns the column of the keys of a block mapping or the
+// entries of a block list.
+func collectionColumn(node ast.Node) (int, bool) {
+	switch n := node.(type) {
+	case *ast.MappingNode:
+		if !n.IsFlowStyle && len(n.Values) > 0 {
+			return n.Values[0].Key.GetToken().Position.Column, true
+		}
+	case *ast.SequenceNode:
+		if !n.IsFlowStyle {
+			return n.Start.Position.Column, true
+		}
+	}
+	return 0, false
+}
+
+// applyMergeTags walks the decoded value along its YAML node, wraps every list
+// carrying a merge tag into a taggedList and replaces keys tagged with !delete
+// by a deleteMarker.
+func applyMergeTags(value any, node ast.Node) (any, error) {
+	switch n := node.(type) {
+	case *ast.TagNode:
+		if n.Start.Value == deleteTag {
+			return deleteMarker{}, nil
+		}
+		inner, err := applyMergeTags(value, n.Value)
+		if err != nil {
+			return nil, err
+		}
+		rule, ok := parseListMergeTag(n.Start.Value)
+		if !ok {
+			return inner, nil
+		}
+		items, ok := inner.([]any)
+		if !ok {
+			return nil, fmt.Errorf("line %d: merge tag %s can only be used on lists", n.Start.Position.Line, n.Start.Value)
+		}
+		return taggedList{rule: rule, items: items}, nil
+	case *ast.AnchorNode:
+		return applyMergeTags(value, n.Value)
+	case *ast.MappingNode:
+		for _, pair := range n.Values {
+			if _, err := applyMergeTags(value, pair); err != nil {
+				return nil, err
+			}
+		}
+	case *ast.MappingValueNode:
+		m, ok := asMap(value)
+		if !ok {
+			return value, nil
+		}
+		key := n.Key.GetToken().Value
+		if item, exists := m[key]; exists {
+			tagged, err := applyMergeTags(item, n.Value)
 			if err != nil {
-				return fmt.Errorf("error opening file %s: %v", path, err)
+				return nil, err
+			}
+			m[key] = tagged
+		}
+	case *ast.SequenceNode:
+		list, ok := value.([]any)
+		if !ok || len(list) != len(n.Values) {
+			return value, nil
+		}
+		for i, itemNode := range n.Values {
+			if tag, ok := itemNode.(*ast.TagNode); ok && tag.Start.Value == deleteTag {
+				return nil, fmt.Errorf("line %d: %s can only be used on mapping values", tag.Start.Position.Line, deleteTag)
 			}
-			content, err := io.ReadAll(f)
+			tagged, err := applyMergeTags(list[i], itemNode)
 			if err != nil {
-				return fmt.Errorf("error reading file %s: %v", path, err)
+				return nil, err
 			}
+			list[i] = tagged
+		}
+	}
+	return value, nil
+}
+
+// mergeDataDir merges every data file below dirPath into mergedData, in
+// lexical order, and records the origin of every value in prov. Files without
+// a registered decoder are skipped with a warning.
+func mergeDataDir(mergedData Data, prov provenance, dirPath string) (Data, error) {
+	err := filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || info.Name() == overlayMetaFile {
+			return nil
+		}
+
+		decoder, ok := decoderFor(path)
+		if !ok {
+			logger.Warn("skipping data file without a decoder for its extension",
+				zap.String("path", path),
+			)
+			return nil
+		}
 
-			// Parse YAML content
-			var data Data
-			if err := yaml.Unmarshal(content, &data); err != nil {
-				return fmt.Errorf("error parsing YAML from %s: %v", path, err)
+		// Read the data file
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("error opening file %s: %v", path, err)
+		}
+		defer f.Close()
+		content, err := io.ReadAll(f)
+		if err != nil {
+			return fmt.Errorf("error reading file %s: %v", path, err)
+		}
+
+		// Parse the content
+		documents, err := decoder.decode(content)
+		if err != nil {
+			return fmt.Errorf("error parsing %s from %s: %v", decoder.format, path, err)
+		}
+
+		// SOPS encrypted files are merged in plaintext
+		encrypted, err := isSOPSEncrypted(decoder, documents)
+		if err != nil {
+			return fmt.Errorf("error decrypting %s: %v", path, err)
+		}
+		if encrypted {
+			documents, err = decryptSOPS(decoder, content, documents)
+			if err != nil {
+				return fmt.Errorf("error decrypting %s: %v", path, err)
 			}
+		}
 
-			// Merge with existing data
-			mergedData = mergeData(mergedData, data)
+		// Merge with existing data, one document after the other
+		for _, doc := range documents {
+			prov.record(doc, mergedData, path, dirPath)
+			mergedData = mergeData(mergedData, doc.data)
 		}
 		return nil
 	})
+	return mergedData, err
+}
+
+// loadAndMergeYAMLFiles merges the base directory with each overlay layer in
+// order. Overlays may extend other overlays, see resolveOverlayLayers.
+func loadAndMergeYAMLFiles(baseDirPath string, overlayDirPaths ...string) (Data, error) {
+	mergedData, _, err := loadAndTrackYAMLFiles(baseDirPath, overlayDirPaths...)
+	return mergedData, err
+}
 
-	if errWalkOverlays != nil {
-		errs = errors.Join(errWalkOverlays)
+// loadAndTrackYAMLFiles is loadAndMergeYAMLFiles, but also returns where every
+// value of the merged data came from.
+func loadAndTrackYAMLFiles(baseDirPath string, overlayDirPaths ...string) (Data, provenance, error) {
+	layers, err := resolveOverlayLayers(overlayDirPaths)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	mergedData := make(Data)
+	prov := make(provenance)
+	var errs error
+	for _, dirPath := range append([]string{baseDirPath}, layers...) {
+		var errWalk error
+		mergedData, errWalk = mergeDataDir(mergedData, prov, dirPath)
+		if errWalk != nil {
+			errs = errors.Join(errs, errWalk)
+		}
 	}
 
 	if errs != nil {
-		return nil, errs
+		return nil, nil, errs
 	}
 
-	return mergedData, nil
+	return mergedData, prov, nil
 }
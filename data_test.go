@@ -58,6 +58,377 @@ func TestLoadAndMergeYAMLFiles(t *testing.T) {
 }
 
 
+func TestLoadAndMergeYAMLFiles_ListMergeTags(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "base", "data.yaml"), `
+usernames: [Viva26, Viola32]
+passwords: [base]
+hosts: [a, b]
+services:
+  - name: web
+    port: 80
+  - name: api
+    port: 8080
+`)
+	writeTestFile(t, filepath.Join(dir, "overlay", "data.yaml"), `
+usernames: !append [Oswald85]
+passwords: !prepend [overlay]
+hosts: !replace [c]
+services: !merge:name
+  - name: api
+    port: 9090
+  - name: db
+    port: 5432
+new: !append [fresh]
+`)
+
+	merged, err := loadAndMergeYAMLFiles(filepath.Join(dir, "base"), filepath.Join(dir, "overlay"))
+	if err != nil {
+		t.Fatalf("loadAndMergeYAMLFiles returned error: %v", err)
+	}
+
+	expected := Data{
+		"usernames": []any{"Viva26", "Viola32", "Oswald85"},
+		"passwords": []any{"overlay", "base"},
+		"hosts":     []any{"c"},
+		"services": []any{
+			map[string]any{"name": "web", "port": uint64(80)},
+			Data{"name": "api", "port": uint64(9090)},
+			map[string]any{"name": "db", "port": uint64(5432)},
+		},
+		"new": []any{"fresh"},
+	}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("expected merged data %v, got %v", expected, merged)
+	}
+}
+
+func TestLoadAndMergeYAMLFiles_ListMergeRules(t *testing.T) {
+	listMergeRules = []listMergeRule{
+		{Path: "usernames", Strategy: listAppend},
+		{Path: "clusters.*.nodes", Strategy: listMerge, Key: "id"},
+	}
+	defer func() { listMergeRules = nil }()
+
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "base", "data.yaml"), `
+usernames: [Viva26]
+passwords: [base]
+clusters:
+  a:
+    nodes:
+      - id: 1
+        size: small
+`)
+	writeTestFile(t, filepath.Join(dir, "overlay", "data.yaml"), `
+usernames: [Viola32]
+passwords: [overlay]
+clusters:
+  a:
+    nodes:
+      - id: 1
+        size: large
+      - id: 2
+        size: small
+`)
+
+	merged, err := loadAndMergeYAMLFiles(filepath.Join(dir, "base"), filepath.Join(dir, "overlay"))
+	if err != nil {
+		t.Fatalf("loadAndMergeYAMLFiles returned error: %v", err)
+	}
+
+	expected := Data{
+		"usernames": []any{"Viva26", "Viola32"},
+		"passwords": []any{"overlay"},
+		"clusters": Data{
+			"a": Data{
+				"nodes": []any{
+					Data{"id": uint64(1), "size": "large"},
+					map[string]any{"id": uint64(2), "size": "small"},
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("expected merged data %v, got %v", expected, merged)
+	}
+}
+
+func TestSameListMergeKey(t *testing.T) {
+	tests := []struct {
+		a, b     any
+		expected bool
+	}{
+		{"web", "web", true},
+		{uint64(1), int64(1), true},
+		{uint64(1), float64(1), true},
+		{uint64(1), "1", false},
+		{true, "true", false},
+		{nil, "<nil>", false},
+		{"web", "api", false},
+	}
+	for _, test := range tests {
+		a := map[string]any{"id": test.a}
+		b := Data{"id": test.b}
+		if sameListMergeKey(a, b, "id") != test.expected {
+			t.Errorf("%#v and %#v: expected sameListMergeKey %t", test.a, test.b, test.expected)
+		}
+	}
+	if sameListMergeKey(map[string]any{"id": 1}, map[string]any{"name": 1}, "id") {
+		t.Error("expected maps without the key not to match")
+	}
+}
+
+func TestLoadAndMergeYAMLFiles_MergeTagOnScalar(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "base", "data.yaml"), "usernames: [Viva26]\n")
+	writeTestFile(t, filepath.Join(dir, "overlay", "data.yaml"), "usernames: !append Viola32\n")
+
+	_, err := loadAndMergeYAMLFiles(filepath.Join(dir, "base"), filepath.Join(dir, "overlay"))
+	if err == nil {
+		t.Fatal("expected an error due to a merge tag on a scalar, but got nil")
+	}
+	if !strings.Contains(err.Error(), "can only be used on lists") {
+		t.Errorf("expected merge tag error, got %q", err.Error())
+	}
+}
+
+func TestListMergeRuleValidate(t *testing.T) {
+	rule := listMergeRule{Path: "services", Strategy: listMerge}
+	if err := rule.validate(); err != nil {
+		t.Fatalf("validate returned error: %v", err)
+	}
+	if rule.Key != defaultListMergeKey {
+		t.Errorf("expected default key %q, got %q", defaultListMergeKey, rule.Key)
+	}
+
+	rule = listMergeRule{Path: "services", Strategy: "shuffle"}
+	if err := rule.validate(); err == nil {
+		t.Error("expected an error for an unknown strategy, but got nil")
+	}
+}
+
+func TestLoadAndMergeYAMLFiles_Delete(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "base", "data.yaml"), `
+name: Charlie Cartwright
+debug: true
+nullable: value
+network:
+  cidr: 10.0.0.1/16
+  dev_proxy: proxy.local
+  dev_tools:
+    enabled: true
+`)
+	writeTestFile(t, filepath.Join(dir, "overlay", "data.yaml"), `
+debug: !delete
+nullable: null
+network:
+  dev_proxy: !delete # not in prod
+  dev_tools: !delete ~
+  vpn: !delete
+unknown:
+  nested: !delete
+`)
+
+	merged, err := loadAndMergeYAMLFiles(filepath.Join(dir, "base"), filepath.Join(dir, "overlay"))
+	if err != nil {
+		t.Fatalf("loadAndMergeYAMLFiles returned error: %v", err)
+	}
+
+	expected := Data{
+		"name":     "Charlie Cartwright",
+		"nullable": nil,
+		"network":  Data{"cidr": "10.0.0.1/16"},
+		"unknown":  map[string]any{},
+	}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("expected merged data %v, got %v", expected, merged)
+	}
+}
+
+func TestDecodeYAML_BareDelete(t *testing.T) {
+	documents, err := decodeYAML([]byte(`
+notes: |
+  run: !delete
+  done
+network:
+  proxy:
+    host: !delete
+  dev: !delete
+cidr: 10.0.0.1/16
+services:
+  - name: api
+    port: !delete
+  - name: db
+last: !delete
+`))
+	if err != nil {
+		t.Fatalf("decodeYAML returned error: %v", err)
+	}
+
+	expected := Data{
+		"notes": "run: !delete\ndone\n",
+		"network": map[string]any{
+			"proxy": map[string]any{"host": deleteMarker{}},
+			"dev":   deleteMarker{},
+		},
+		"cidr": "10.0.0.1/16",
+		"services": []any{
+			map[string]any{"name": "api", "port": deleteMarker{}},
+			map[string]any{"name": "db"},
+		},
+		"last": deleteMarker{},
+	}
+	if len(documents) != 1 || !reflect.DeepEqual(documents[0].data, expected) {
+		t.Errorf("expected decoded data %v, got %v", expected, documents)
+	}
+}
+
+func TestDecodeYAML_FlowDelete(t *testing.T) {
+	documents, err := decodeYAML([]byte("x: {a: !delete ~, b: 1}\n"))
+	if err != nil {
+		t.Fatalf("decodeYAML returned error: %v", err)
+	}
+	expected := Data{"x": map[string]any{"a": deleteMarker{}, "b": uint64(1)}}
+	if len(documents) != 1 || !reflect.DeepEqual(documents[0].data, expected) {
+		t.Errorf("expected decoded data %v, got %v", expected, documents)
+	}
+
+	// A bare !delete can not be parsed in flow style
+	for _, content := range []string{
+		"x: {a: !delete, b: 1}\n",
+		"name: app\n---\nname: db\nx: {b: 1, a: !delete}\n",
+	} {
+		_, err := decodeYAML([]byte(content))
+		if err == nil || !strings.Contains(err.Error(), "!delete needs a value in flow style, write !delete ~") {
+			t.Errorf("%q: expected a flow style error, got %v", content, err)
+		}
+	}
+	_, err = decodeYAML([]byte("name: app\n---\nname: db\nx: {b: 1, a: !delete}\n"))
+	if err == nil || !strings.HasPrefix(err.Error(), "document 2: line 4:") {
+		t.Errorf("expected the error in document 2 on line 4, got %v", err)
+	}
+}
+
+func TestLoadAndMergeYAMLFiles_DeleteInList(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "base", "data.yaml"), "usernames: [Viva26]\n")
+	writeTestFile(t, filepath.Join(dir, "overlay", "data.yaml"), "usernames:\n  - !delete\n")
+
+	_, err := loadAndMergeYAMLFiles(filepath.Join(dir, "base"), filepath.Join(dir, "overlay"))
+	if err == nil {
+		t.Fatal("expected an error due to !delete in a list, but got nil")
+	}
+	if !strings.Contains(err.Error(), "can only be used on mapping values") {
+		t.Errorf("expected delete tag error, got %q", err.Error())
+	}
+}
+
+func TestLoadAndMergeYAMLFiles_MultiDocument(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "base", "data.yaml"), `---
+name: Charlie Cartwright
+network:
+  cidr: 10.0.0.1/16
+---
+network:
+  vpn_password: $$vpn_password$$
+---
+name: Viva26
+usernames: [Viva26]
+---
+`)
+	writeTestFile(t, filepath.Join(dir, "overlay", "data.yaml"), "usernames: !append [Viola32]\n---\nage: 120\n")
+
+	merged, err := loadAndMergeYAMLFiles(filepath.Join(dir, "base"), filepath.Join(dir, "overlay"))
+	if err != nil {
+		t.Fatalf("loadAndMergeYAMLFiles returned error: %v", err)
+	}
+
+	expected := Data{
+		"name":      "Viva26",
+		"age":       uint64(120),
+		"usernames": []any{"Viva26", "Viola32"},
+		"network":   Data{"cidr": "10.0.0.1/16", "vpn_password": "$$vpn_password$$"},
+	}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("expected merged data %v, got %v", expected, merged)
+	}
+}
+
+func TestDecodeYAML_DocumentErrors(t *testing.T) {
+	testCases := []struct {
+		name        string
+		content     string
+		expectedErr string
+	}{
+		{
+			name:        "syntax_error",
+			content:     "name: a\n---\nname: b\n---\ninvalid: yaml: : content\n",
+			expectedErr: "document 3:",
+		},
+		{
+			name:        "leading_separator",
+			content:     "# data\n---\nname: a\n---\ninvalid: yaml: : content\n",
+			expectedErr: "document 2:",
+		},
+		{
+			name:        "not_a_mapping",
+			content:     "name: a\n---\n- a list\n",
+			expectedErr: "document 2:",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := decodeYAML([]byte(tc.content))
+			if err == nil {
+				t.Fatal("expected an error, but got nil")
+			}
+			if !strings.HasPrefix(err.Error(), tc.expectedErr) {
+				t.Errorf("expected error to start with %q, got %q", tc.expectedErr, err.Error())
+			}
+		})
+	}
+}
+
+func TestValidateData_SchemaDefaults(t *testing.T) {
+	defer func(previous string) { schemaFile = previous }(schemaFile)
+	schemaFile = `
+#Schema: {
+	name:     string
+	replicas: *3 | int
+	fqdn:     "\(name).example.com"
+	network: {
+		cidr: *"10.0.0.0/16" | string
+	}
+}`
+
+	validated, err := validateData(Data{"name": "api", "network": map[string]any{}})
+	if err != nil {
+		t.Fatalf("validateData returned error: %v", err)
+	}
+
+	expected := Data{
+		"name":     "api",
+		"replicas": int64(3),
+		"fqdn":     "api.example.com",
+		"network":  map[string]any{"cidr": "10.0.0.0/16"},
+	}
+	if !reflect.DeepEqual(validated, expected) {
+		t.Errorf("expected validated data %v, got %v", expected, validated)
+	}
+}
+
+func TestValidateData_Incomplete(t *testing.T) {
+	// network is required by the schema
+	_, err := validateData(Data{"name": "Charlie Cartwright"})
+	if err == nil {
+		t.Fatal("expected an error due to the missing network, but got nil")
+	}
+}
+
 func TestLoadAndMergeYAMLFiles_InvalidYAML(t *testing.T) {
 	// Create temporary directories for base and overlay YAML files.
 	baseDir, err := os.MkdirTemp("", "baseDir")
@@ -98,3 +469,91 @@ func TestLoadAndMergeYAMLFiles_InvalidYAML(t *testing.T) {
 		t.Errorf("expected error to contain %q, but got %q", expectedErrSubstring, err.Error())
 	}
 }
+
+// writeTestFile writes content to path, creating parent directories.
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("failed to create directory for %s: %v", path, err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+}
+
+func TestLoadAndMergeYAMLFiles_OverlayLayers(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "base", "data.yaml"), "layer: base\nbase: true\nnetwork:\n  cidr: 10.0.0.0/8\n")
+	writeTestFile(t, filepath.Join(dir, "overlays", "eu", "data.yaml"), "layer: eu\nregion: eu\n")
+	writeTestFile(t, filepath.Join(dir, "overlays", "prod", overlayMetaFile), "extends:\n  - ../eu\n")
+	writeTestFile(t, filepath.Join(dir, "overlays", "prod", "data.yaml"), "layer: prod\nnetwork:\n  cidr: 10.1.0.0/16\n")
+	writeTestFile(t, filepath.Join(dir, "clusters", "a", "data.yaml"), "layer: cluster-a\ncluster: a\n")
+
+	merged, err := loadAndMergeYAMLFiles(
+		filepath.Join(dir, "base"),
+		filepath.Join(dir, "overlays", "prod"),
+		filepath.Join(dir, "clusters", "a"),
+	)
+	if err != nil {
+		t.Fatalf("loadAndMergeYAMLFiles returned error: %v", err)
+	}
+
+	expected := Data{
+		"layer":   "cluster-a",
+		"base":    true,
+		"region":  "eu",
+		"cluster": "a",
+		"network": Data{"cidr": "10.1.0.0/16"},
+	}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("expected merged data %v, got %v", expected, merged)
+	}
+}
+
+func TestResolveOverlayLayers_Order(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "region", "data.yaml"), "")
+	writeTestFile(t, filepath.Join(dir, "env", overlayMetaFile), "extends: [../region]\n")
+	writeTestFile(t, filepath.Join(dir, "cluster", overlayMetaFile), "extends: [../env, ../region]\n")
+
+	layers, err := resolveOverlayLayers([]string{filepath.Join(dir, "cluster"), filepath.Join(dir, "env")})
+	if err != nil {
+		t.Fatalf("resolveOverlayLayers returned error: %v", err)
+	}
+
+	expected := []string{
+		filepath.Join(dir, "region"),
+		filepath.Join(dir, "env"),
+		filepath.Join(dir, "cluster"),
+	}
+	if !reflect.DeepEqual(layers, expected) {
+		t.Errorf("expected layers %v, got %v", expected, layers)
+	}
+}
+
+func TestResolveOverlayLayers_Cycle(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a", overlayMetaFile), "extends: [../b]\n")
+	writeTestFile(t, filepath.Join(dir, "b", overlayMetaFile), "extends: [../a]\n")
+
+	_, err := resolveOverlayLayers([]string{filepath.Join(dir, "a")})
+	if err == nil {
+		t.Fatal("expected an error due to the overlay cycle, but got nil")
+	}
+	if !strings.Contains(err.Error(), "overlay cycle detected") {
+		t.Errorf("expected cycle error, got %q", err.Error())
+	}
+}
+
+func TestResolveOverlayLayers_MissingParent(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "prod", overlayMetaFile), "extends: [../does-not-exist]\n")
+
+	_, err := resolveOverlayLayers([]string{filepath.Join(dir, "prod")})
+	if err == nil {
+		t.Fatal("expected an error due to the missing parent overlay, but got nil")
+	}
+	if !strings.Contains(err.Error(), "does-not-exist") {
+		t.Errorf("expected error to name the missing overlay, got %q", err.Error())
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/subosito/gotenv"
+)
+
+// dataDecoder decodes data files of one format into Data. Formats with
+// several documents per file return them in the order they are merged.
+type dataDecoder struct {
+	// format names the format in error messages.
+	format string
+	decode func(content []byte) ([]dataDocument, error)
+}
+
+// dataDecoders maps file extensions to their decoder, see registerDataDecoder.
+// Files with other extensions are skipped with a warning.
+var dataDecoders = map[string]dataDecoder{}
+
+// registerDataDecoder registers decode for data files with the given
+// extensions, replacing earlier registrations.
+func registerDataDecoder(format string, decode func(content []byte) ([]dataDocument, error), extensions ...string) {
+	for _, extension := range extensions {
+		dataDecoders[extension] = dataDecoder{format: format, decode: decode}
+	}
+}
+
+func init() {
+	registerDataDecoder("YAML", decodeYAML, ".yaml", ".yml")
+	registerDataDecoder("JSON", singleDocument(decodeJSON), ".json")
+	registerDataDecoder("TOML", singleDocument(decodeTOML), ".toml")
+	registerDataDecoder("dotenv", singleDocument(decodeDotenv), ".env")
+}
+
+// singleDocument adapts a decoder for formats with one document per file.
+func singleDocument(decode func(content []byte) (Data, error)) func(content []byte) ([]dataDocument, error) {
+	return func(content []byte) ([]dataDocument, error) {
+		data, err := decode(content)
+		if err != nil {
+			return nil, err
+		}
+		return []dataDocument{{data: data}}, nil
+	}
+}
+
+// decodeJSON decodes a JSON object. Integral numbers are kept as integers so
+// they pass int constraints of the schema.
+func decodeJSON(content []byte) (Data, error) {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+
+	var data Data
+	if err := decoder.Decode(&data); err != nil {
+		return nil, err
+	}
+	normalizeJSONNumbers(data)
+	return data, nil
+}
+
+// normalizeJSONNumbers replaces every json.Number below value by an int64 or,
+// if it has a fraction or does not fit, a float64.
+func normalizeJSONNumbers(value any) any {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case Data:
+		for key, item := range v {
+			v[key] = normalizeJSONNumbers(item)
+		}
+	case map[string]any:
+		for key, item := range v {
+			v[key] = normalizeJSONNumbers(item)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = normalizeJSONNumbers(item)
+		}
+	}
+	return value
+}
+
+// decodeTOML decodes a TOML document.
+func decodeTOML(content []byte) (Data, error) {
+	var data Data
+	if err := toml.Unmarshal(content, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// decodeDotenv decodes a .env file into top-level string values.
+func decodeDotenv(content []byte) (Data, error) {
+	env, err := gotenv.StrictParse(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+
+	data := make(Data, len(env))
+	for key, value := range env {
+		data[key] = value
+	}
+	return data, nil
+}
+
+// decoderFor returns the decoder registered for the extension of path.
+func decoderFor(path string) (dataDecoder, bool) {
+	decoder, ok := dataDecoders[filepath.Ext(path)]
+	return decoder, ok
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestDecodeJSON(t *testing.T) {
+	data, err := decodeJSON([]byte(`{"name": "vpc", "age": 120, "ratio": 0.5, "subnets": [{"size": 24}]}`))
+	if err != nil {
+		t.Fatalf("decodeJSON returned error: %v", err)
+	}
+
+	expected := Data{
+		"name":    "vpc",
+		"age":     int64(120),
+		"ratio":   0.5,
+		"subnets": []any{map[string]any{"size": int64(24)}},
+	}
+	if !reflect.DeepEqual(data, expected) {
+		t.Errorf("expected %v, got %v", expected, data)
+	}
+}
+
+func TestDecodeTOML(t *testing.T) {
+	data, err := decodeTOML([]byte("name = \"vpc\"\nage = 120\n\n[network]\ncidr = \"10.0.0.1/16\"\n"))
+	if err != nil {
+		t.Fatalf("decodeTOML returned error: %v", err)
+	}
+
+	expected := Data{
+		"name":    "vpc",
+		"age":     int64(120),
+		"network": map[string]any{"cidr": "10.0.0.1/16"},
+	}
+	if !reflect.DeepEqual(data, expected) {
+		t.Errorf("expected %v, got %v", expected, data)
+	}
+}
+
+func TestDecodeDotenv(t *testing.T) {
+	data, err := decodeDotenv([]byte("# comment\nREGION=eu-west-1\nexport ZONE=\"b\"\n"))
+	if err != nil {
+		t.Fatalf("decodeDotenv returned error: %v", err)
+	}
+
+	expected := Data{"REGION": "eu-west-1", "ZONE": "b"}
+	if !reflect.DeepEqual(data, expected) {
+		t.Errorf("expected %v, got %v", expected, data)
+	}
+}
+
+func TestLoadAndMergeYAMLFiles_MixedFormats(t *testing.T) {
+	core, logs := observer.New(zapcore.WarnLevel)
+	defer func(previous *zap.Logger) { logger = previous }(logger)
+	logger = zap.New(core)
+
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "base", "data.yaml"), "name: Charlie Cartwright\nage: 120\n")
+	writeTestFile(t, filepath.Join(dir, "base", "README.md"), "# not data\n")
+	writeTestFile(t, filepath.Join(dir, "overlay", "a_terraform.json"), `{"network": {"cidr": "10.0.0.1/16"}}`)
+	writeTestFile(t, filepath.Join(dir, "overlay", "b_settings.toml"), "age = 121\n")
+	writeTestFile(t, filepath.Join(dir, "overlay", ".env"), "REGION=eu-west-1\n")
+
+	merged, err := loadAndMergeYAMLFiles(filepath.Join(dir, "base"), filepath.Join(dir, "overlay"))
+	if err != nil {
+		t.Fatalf("loadAndMergeYAMLFiles returned error: %v", err)
+	}
+
+	expected := Data{
+		"name":    "Charlie Cartwright",
+		"age":     int64(121),
+		"network": map[string]any{"cidr": "10.0.0.1/16"},
+		"REGION":  "eu-west-1",
+	}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("expected merged data %v, got %v", expected, merged)
+	}
+
+	warnings := logs.FilterMessageSnippet("without a decoder").All()
+	if len(warnings) != 1 || !strings.HasSuffix(warnings[0].ContextMap()["path"].(string), "README.md") {
+		t.Errorf("expected one warning for README.md, got %v", warnings)
+	}
+}
+
+func TestLoadAndMergeYAMLFiles_InvalidJSON(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "base", "data.json"), `{"name": `)
+	writeTestFile(t, filepath.Join(dir, "overlay", "data.yaml"), "overlay: valid\n")
+
+	_, err := loadAndMergeYAMLFiles(filepath.Join(dir, "base"), filepath.Join(dir, "overlay"))
+	if err == nil {
+		t.Fatal("expected an error due to invalid JSON, but got nil")
+	}
+	if !strings.Contains(err.Error(), "error parsing JSON") {
+		t.Errorf("expected error to contain %q, but got %q", "error parsing JSON", err.Error())
+	}
+}
@@ -1,106 +1,180 @@
 package main
 
 import (
+	"context"
 	"regexp"
-	"strings"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/alxndr13/dingo/decrypt"
 )
 
 const REGEX_STRING string = `\$\$(.*?)\$\$`
 
-// Decryptor interface for decrypting secrets
+// Decryptor interface for decrypting secrets. Decrypt is called concurrently
+// once Init returned.
 type Decryptor interface {
 	Init() error
 	Decrypt(secretName string) (string, error)
 }
 
-// decryptSecrets recursively decrypts values in a Data map.
+// secretWorkers bounds the number of secrets resolved concurrently. Set by
+// initConfig from secrets.workers.
+var secretWorkers = 8
+
+// decryptSecrets decrypts the secret references in every string of a Data
+// map, see decryptSecretsContext.
 func decryptSecrets(data *Data, decryptor Decryptor) error {
+	return decryptSecretsContext(context.Background(), data, decrypt.WithContext(decryptor))
+}
+
+// decryptSecretsContext decrypts the secret references in every string of a
+// Data map. It collects the unique references of the whole tree first, so
+// every secret is resolved once, then initialises the decryptor once and
+// resolves them with up to secretWorkers concurrent calls. Once ctx is done no
+// more secrets are requested, and the calls in flight are canceled.
+func decryptSecretsContext(ctx context.Context, data *Data, decryptor decrypt.ContextDecryptor) error {
 	secretPattern := regexp.MustCompile(REGEX_STRING)
 
-	for k, v := range *data {
-		switch value := v.(type) {
-		case string:
-			matches := secretPattern.FindAllStringSubmatch(value, -1)
-			newStr := value
-			for _, match := range matches {
-				secretName := match[1]
-				err := decryptor.Init()
-				if err != nil {
-					return err
+	refs := make(map[string]struct{})
+	collectSecrets(*data, secretPattern, refs)
+	if len(refs) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(refs))
+	for name := range refs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if err := decryptor.InitContext(ctx); err != nil {
+		return err
+	}
+	values, err := resolveSecrets(ctx, decryptor, names)
+	if err != nil {
+		return err
+	}
+
+	replaceSecrets(*data, secretPattern, values)
+	return nil
+}
+
+// collectSecrets adds the names of the secret references in value and every
+// value below it to refs.
+func collectSecrets(value any, secretPattern *regexp.Regexp, refs map[string]struct{}) {
+	switch value := value.(type) {
+	case string:
+		for _, match := range secretPattern.FindAllStringSubmatch(value, -1) {
+			refs[match[1]] = struct{}{}
+		}
+	case map[string]any:
+		for _, v := range value {
+			collectSecrets(v, secretPattern, refs)
+		}
+	// used for tests, basically the same as map[string]any
+	case Data:
+		for _, v := range value {
+			collectSecrets(v, secretPattern, refs)
+		}
+	case []any:
+		for _, v := range value {
+			collectSecrets(v, secretPattern, refs)
+		}
+	}
+}
+
+// resolveSecrets decrypts every secret name with a bounded pool of workers and
+// returns the values by name. No new secrets are requested once one failed or
+// ctx is done; the error of the first failed name is returned as it is, or the
+// context error if ctx is done.
+func resolveSecrets(ctx context.Context, decryptor decrypt.ContextDecryptor, names []string) (map[string]string, error) {
+	values := make([]string, len(names))
+	errs := make([]error, len(names))
+
+	var failed atomic.Bool
+	var wg sync.WaitGroup
+	jobs := make(chan int)
+	for range max(1, min(secretWorkers, len(names))) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if failed.Load() || ctx.Err() != nil {
+					continue
 				}
-				decryptedValue, err := decryptor.Decrypt(secretName)
-				if err != nil {
-					return err
+				values[i], errs[i] = decryptor.DecryptContext(ctx, names[i])
+				if errs[i] != nil {
+					failed.Store(true)
 				}
-				newStr = strings.ReplaceAll(newStr, match[0], decryptedValue)
 			}
-			(*data)[k] = newStr
+		}()
+	}
+	for i := range names {
+		if failed.Load() || ctx.Err() != nil {
+			break
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	resolved := make(map[string]string, len(names))
+	for i, name := range names {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		resolved[name] = values[i]
+	}
+	return resolved, nil
+}
+
+// replaceSecrets recursively replaces the secret references in a Data map
+// with their values.
+func replaceSecrets(data Data, secretPattern *regexp.Regexp, values map[string]string) {
+	for k, v := range data {
+		switch value := v.(type) {
+		case string:
+			data[k] = replaceSecretReferences(value, secretPattern, values)
 		case map[string]any:
 			// Recursively process nested maps.
 			nestedData := Data(value)
-			if err := decryptSecrets(&nestedData, decryptor); err != nil {
-				return err
-			}
-			(*data)[k] = nestedData
+			replaceSecrets(nestedData, secretPattern, values)
+			data[k] = nestedData
 		// used for tests, basically the same as map[string]any
 		case Data:
-			// Process nested maps of the custom Data type.
-			if err := decryptSecrets(&value, decryptor); err != nil {
-				return err
-			}
-			(*data)[k] = value
+			replaceSecrets(value, secretPattern, values)
 		case []any:
-			// Process slices using a helper function.
-			newList, err := decryptSecretsInSlice(value, decryptor)
-			if err != nil {
-				return err
-			}
-			(*data)[k] = newList
+			replaceSecretsInSlice(value, secretPattern, values)
 		}
 	}
-	return nil
 }
 
-// decryptSecretsInSlice recursively processes entries in a slice.
-func decryptSecretsInSlice(list []any, decryptor Decryptor) ([]any, error) {
-	secretPattern := regexp.MustCompile(REGEX_STRING)
+// replaceSecretsInSlice recursively processes entries in a slice.
+func replaceSecretsInSlice(list []any, secretPattern *regexp.Regexp, values map[string]string) {
 	for i, v := range list {
 		switch value := v.(type) {
 		case string:
-			matches := secretPattern.FindAllStringSubmatch(value, -1)
-			newStr := value
-			for _, match := range matches {
-				secretName := match[1]
-				err := decryptor.Init()
-				if err != nil {
-					return nil, err
-				}
-				decryptedValue, err := decryptor.Decrypt(secretName)
-				if err != nil {
-					return nil, err
-				}
-				newStr = strings.ReplaceAll(newStr, match[0], decryptedValue)
-			}
-			list[i] = newStr
+			list[i] = replaceSecretReferences(value, secretPattern, values)
 		case map[string]any:
 			nestedData := Data(value)
-			if err := decryptSecrets(&nestedData, decryptor); err != nil {
-				return nil, err
-			}
+			replaceSecrets(nestedData, secretPattern, values)
 			list[i] = nestedData
 		case Data:
-			nestedData := Data(value)
-			if err := decryptSecrets(&nestedData, decryptor); err != nil {
-				return nil, err
-			}
-			list[i] = nestedData
+			replaceSecrets(value, secretPattern, values)
 		case []any:
-			newList, err := decryptSecretsInSlice(value, decryptor)
-			if err != nil {
-				return nil, err
-			}
-			list[i] = newList
+			replaceSecretsInSlice(value, secretPattern, values)
 		}
 	}
-	return list, nil
+}
+
+// replaceSecretReferences replaces the secret references in s with their
+// values.
+func replaceSecretReferences(s string, secretPattern *regexp.Regexp, values map[string]string) string {
+	return secretPattern.ReplaceAllStringFunc(s, func(match string) string {
+		return values[secretPattern.FindStringSubmatch(match)[1]]
+	})
 }
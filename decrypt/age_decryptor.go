@@ -0,0 +1,122 @@
+package decrypt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+)
+
+// AgeDecryptor decrypts secrets encrypted with age, so they can be committed
+// alongside the data files. Secret names are the base64 encoded age
+// ciphertext, as written by EncryptAge.
+type AgeDecryptor struct {
+	// IdentityFile is the age identity file to decrypt with. Defaults to
+	// DINGO_AGE_IDENTITY_FILE, falling back to SOPS_AGE_KEY_FILE.
+	IdentityFile string
+
+	identities []age.Identity
+}
+
+func NewAgeDecryptor() *AgeDecryptor {
+	return &AgeDecryptor{}
+}
+
+// Init reads the identities of the identity file.
+func (d *AgeDecryptor) Init() error {
+	setFromEnv(&d.IdentityFile, "DINGO_AGE_IDENTITY_FILE")
+	setFromEnv(&d.IdentityFile, "SOPS_AGE_KEY_FILE")
+	if len(d.IdentityFile) == 0 {
+		return fmt.Errorf("no age identity file, set DINGO_AGE_IDENTITY_FILE")
+	}
+
+	f, err := os.Open(d.IdentityFile)
+	if err != nil {
+		return fmt.Errorf("failed to open age identity file: %w", err)
+	}
+	defer f.Close()
+
+	d.identities, err = age.ParseIdentities(f)
+	if err != nil {
+		return fmt.Errorf("failed to parse age identity file %s: %w", d.IdentityFile, err)
+	}
+	return nil
+}
+
+func (d *AgeDecryptor) Decrypt(secretName string) (string, error) {
+	if len(d.identities) == 0 {
+		return "", fmt.Errorf("age decryptor is not initialised")
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(secretName)
+	if err != nil {
+		return "", fmt.Errorf("age secret is not base64 encoded: %w", err)
+	}
+	r, err := age.Decrypt(bytes.NewReader(ciphertext), d.identities...)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt age secret: %w", err)
+	}
+	plaintext, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt age secret: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// ParseAgeRecipients parses age recipients, e.g. age1ql3z7hjy54pw3hyww5ay....
+func ParseAgeRecipients(values ...string) ([]age.Recipient, error) {
+	var recipients []age.Recipient
+	for _, value := range values {
+		recipient, err := age.ParseX25519Recipient(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid age recipient %q: %w", value, err)
+		}
+		recipients = append(recipients, recipient)
+	}
+	return recipients, nil
+}
+
+// ReadAgeRecipientsFile reads a file of age recipients, one per line, with
+// empty lines and # comments ignored.
+func ReadAgeRecipientsFile(path string) ([]age.Recipient, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open age recipients file: %w", err)
+	}
+	defer f.Close()
+
+	recipients, err := age.ParseRecipients(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse age recipients file %s: %w", path, err)
+	}
+	return recipients, nil
+}
+
+// EncryptAge encrypts plaintext for every recipient and returns the base64
+// encoded ciphertext, the secret name AgeDecryptor decrypts.
+func EncryptAge(plaintext string, recipients ...age.Recipient) (string, error) {
+	if len(recipients) == 0 {
+		return "", fmt.Errorf("no age recipients")
+	}
+
+	var ciphertext bytes.Buffer
+	w, err := age.Encrypt(&ciphertext, recipients...)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt age secret: %w", err)
+	}
+	if _, err := io.WriteString(w, plaintext); err != nil {
+		return "", fmt.Errorf("failed to encrypt age secret: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return "", fmt.Errorf("failed to encrypt age secret: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(ciphertext.Bytes()), nil
+}
+
+func init() {
+	Register("age", func() Decryptor { return NewAgeDecryptor() })
+}
@@ -0,0 +1,104 @@
+package decrypt
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+// writeAgeIdentity writes a new age identity file and returns its path and
+// the identity.
+func writeAgeIdentity(t *testing.T) (string, *age.X25519Identity) {
+	t.Helper()
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("failed to generate age identity: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "keys.txt")
+	content := "# public key: " + identity.Recipient().String() + "\n" + identity.String() + "\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("failed to write age identity: %v", err)
+	}
+	return path, identity
+}
+
+func TestAgeDecryptor_Decrypt(t *testing.T) {
+	alicePath, alice := writeAgeIdentity(t)
+	bobPath, bob := writeAgeIdentity(t)
+
+	recipients, err := ParseAgeRecipients(alice.Recipient().String(), bob.Recipient().String())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ciphertext, err := EncryptAge("s3cr3t", recipients...)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.ContainsAny(ciphertext, "$\n") {
+		t.Fatalf("expected the ciphertext to fit into a secret reference, got %q", ciphertext)
+	}
+
+	// Every recipient can decrypt
+	for _, path := range []string{alicePath, bobPath} {
+		decryptor := NewAgeDecryptor()
+		decryptor.IdentityFile = path
+		if err := decryptor.Init(); err != nil {
+			t.Fatalf("Init returned error: %v", err)
+		}
+		value, err := decryptor.Decrypt(ciphertext)
+		if err != nil || value != "s3cr3t" {
+			t.Errorf("expected s3cr3t, got %q, %v", value, err)
+		}
+	}
+
+	eve, _ := writeAgeIdentity(t)
+	t.Setenv("DINGO_AGE_IDENTITY_FILE", eve)
+	decryptor := NewAgeDecryptor()
+	if err := decryptor.Init(); err != nil {
+		t.Fatalf("Init returned error: %v", err)
+	}
+	if _, err := decryptor.Decrypt(ciphertext); err == nil || !strings.Contains(err.Error(), "no identity matched") {
+		t.Errorf("expected a no matching identity error, got %v", err)
+	}
+	if _, err := decryptor.Decrypt("not base64!"); err == nil || !strings.Contains(err.Error(), "not base64 encoded") {
+		t.Errorf("expected a base64 error, got %v", err)
+	}
+}
+
+func TestAgeDecryptor_Init(t *testing.T) {
+	t.Setenv("DINGO_AGE_IDENTITY_FILE", "")
+	t.Setenv("SOPS_AGE_KEY_FILE", "")
+	if err := NewAgeDecryptor().Init(); err == nil || !strings.Contains(err.Error(), "no age identity file") {
+		t.Errorf("expected a missing identity file error, got %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "keys.txt")
+	os.WriteFile(path, []byte("not an identity\n"), 0600)
+	t.Setenv("SOPS_AGE_KEY_FILE", path)
+	if err := NewAgeDecryptor().Init(); err == nil || !strings.Contains(err.Error(), "failed to parse age identity file") {
+		t.Errorf("expected a parse error, got %v", err)
+	}
+}
+
+func TestParseAgeRecipients(t *testing.T) {
+	_, identity := writeAgeIdentity(t)
+	recipient := identity.Recipient().String()
+
+	if _, err := ParseAgeRecipients(recipient, "age1invalid"); err == nil || !strings.Contains(err.Error(), `invalid age recipient "age1invalid"`) {
+		t.Errorf("expected an invalid recipient error, got %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "recipients.txt")
+	os.WriteFile(path, []byte("# ops team\n"+recipient+"\n\n"), 0644)
+	recipients, err := ReadAgeRecipientsFile(path)
+	if err != nil || len(recipients) != 1 {
+		t.Errorf("expected one recipient, got %v, %v", recipients, err)
+	}
+
+	if _, err := EncryptAge("s3cr3t"); err == nil {
+		t.Error("expected an error without recipients, but got nil")
+	}
+}
@@ -0,0 +1,211 @@
+package decrypt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+// SecretsManagerClient is the part of the AWS Secrets Manager API used by
+// AWSSecretsManagerDecryptor.
+type SecretsManagerClient interface {
+	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+// SSMClient is the part of the AWS Systems Manager API used by
+// AWSSSMDecryptor.
+type SSMClient interface {
+	GetParameter(ctx context.Context, params *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error)
+}
+
+// loadAWSConfig loads the default AWS configuration: credentials, region and
+// endpoints from the environment and the shared config files.
+func loadAWSConfig(ctx context.Context) (aws.Config, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return cfg, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	return cfg, nil
+}
+
+// awsError marks errors the AWS SDK retries, such as throttling and
+// unavailable endpoints, as transient.
+func awsError(err error) error {
+	if retry.IsErrorRetryables(retry.DefaultRetryables).IsErrorRetryable(err) == aws.TrueTernary ||
+		retry.IsErrorThrottles(retry.DefaultThrottles).IsErrorThrottle(err) == aws.TrueTernary {
+		return Transient(err)
+	}
+	return err
+}
+
+// AWSSecretsManagerDecryptor reads secrets from AWS Secrets Manager. Secret
+// names are secret IDs or ARNs. A #<key> suffix extracts a key of a secret
+// holding a JSON object, e.g. prod/db#password.
+type AWSSecretsManagerDecryptor struct {
+	// Endpoint overrides the Secrets Manager endpoint, e.g. for a local
+	// stand-in. Defaults to DINGO_AWS_SECRETSMANAGER_ENDPOINT; the AWS
+	// variables such as AWS_ENDPOINT_URL work as well.
+	Endpoint string
+	// RetryMaxAttempts bounds the attempts of the AWS SDK per call, the SDK
+	// default if it is zero. WithPolicy sets it to 1.
+	RetryMaxAttempts int
+
+	client SecretsManagerClient
+}
+
+func NewAWSSecretsManagerDecryptor() *AWSSecretsManagerDecryptor {
+	return &AWSSecretsManagerDecryptor{}
+}
+
+func (d *AWSSecretsManagerDecryptor) Init() error {
+	return d.InitContext(context.Background())
+}
+
+func (d *AWSSecretsManagerDecryptor) InitContext(ctx context.Context) error {
+	cfg, err := loadAWSConfig(ctx)
+	if err != nil {
+		return err
+	}
+	setFromEnv(&d.Endpoint, "DINGO_AWS_SECRETSMANAGER_ENDPOINT")
+
+	d.client = secretsmanager.NewFromConfig(cfg, func(o *secretsmanager.Options) {
+		if len(d.Endpoint) > 0 {
+			o.BaseEndpoint = aws.String(d.Endpoint)
+		}
+		if d.RetryMaxAttempts > 0 {
+			o.RetryMaxAttempts = d.RetryMaxAttempts
+		}
+	})
+	return nil
+}
+
+func (d *AWSSecretsManagerDecryptor) Decrypt(secretName string) (string, error) {
+	return d.DecryptContext(context.Background(), secretName)
+}
+
+// DecryptContext reads a secret. Errors the AWS SDK retries are transient.
+func (d *AWSSecretsManagerDecryptor) DecryptContext(ctx context.Context, secretName string) (string, error) {
+	id, key, hasKey := strings.Cut(secretName, "#")
+
+	result, err := d.client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(id),
+	})
+	if err != nil {
+		return "", awsError(fmt.Errorf("failed to get secret value of %s: %w", id, err))
+	}
+
+	value := string(result.SecretBinary)
+	if result.SecretString != nil {
+		value = *result.SecretString
+	}
+	if !hasKey {
+		return value, nil
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(value), &fields); err != nil {
+		return "", fmt.Errorf("secret %s is not a JSON object, can not extract key %q", id, key)
+	}
+	field, ok := fields[key]
+	if !ok {
+		return "", fmt.Errorf("secret %s has no key %q", id, key)
+	}
+	if s, ok := field.(string); ok {
+		return s, nil
+	}
+	content, err := json.Marshal(field)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// Close does nothing, the client holds no resources.
+func (d *AWSSecretsManagerDecryptor) Close() error {
+	return nil
+}
+
+func (d *AWSSecretsManagerDecryptor) disableRetries() {
+	d.RetryMaxAttempts = 1
+}
+
+// AWSSSMDecryptor reads SecureString parameters from the AWS Systems Manager
+// Parameter Store. Secret names are parameter names or ARNs, optionally with
+// a version or label selector, e.g. /prod/db/password:3.
+type AWSSSMDecryptor struct {
+	// Endpoint overrides the Systems Manager endpoint, e.g. for a local
+	// stand-in. Defaults to DINGO_AWS_SSM_ENDPOINT; the AWS variables such
+	// as AWS_ENDPOINT_URL work as well.
+	Endpoint string
+	// RetryMaxAttempts bounds the attempts of the AWS SDK per call, the SDK
+	// default if it is zero. WithPolicy sets it to 1.
+	RetryMaxAttempts int
+
+	client SSMClient
+}
+
+func NewAWSSSMDecryptor() *AWSSSMDecryptor {
+	return &AWSSSMDecryptor{}
+}
+
+func (d *AWSSSMDecryptor) Init() error {
+	return d.InitContext(context.Background())
+}
+
+func (d *AWSSSMDecryptor) InitContext(ctx context.Context) error {
+	cfg, err := loadAWSConfig(ctx)
+	if err != nil {
+		return err
+	}
+	setFromEnv(&d.Endpoint, "DINGO_AWS_SSM_ENDPOINT")
+
+	d.client = ssm.NewFromConfig(cfg, func(o *ssm.Options) {
+		if len(d.Endpoint) > 0 {
+			o.BaseEndpoint = aws.String(d.Endpoint)
+		}
+		if d.RetryMaxAttempts > 0 {
+			o.RetryMaxAttempts = d.RetryMaxAttempts
+		}
+	})
+	return nil
+}
+
+func (d *AWSSSMDecryptor) Decrypt(secretName string) (string, error) {
+	return d.DecryptContext(context.Background(), secretName)
+}
+
+// DecryptContext reads a parameter. Errors the AWS SDK retries are transient.
+func (d *AWSSSMDecryptor) DecryptContext(ctx context.Context, secretName string) (string, error) {
+	result, err := d.client.GetParameter(ctx, &ssm.GetParameterInput{
+		Name:           aws.String(secretName),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return "", awsError(fmt.Errorf("failed to get parameter %s: %w", secretName, err))
+	}
+	if result.Parameter == nil || result.Parameter.Value == nil {
+		return "", fmt.Errorf("parameter %s has no value", secretName)
+	}
+	return *result.Parameter.Value, nil
+}
+
+// Close does nothing, the client holds no resources.
+func (d *AWSSSMDecryptor) Close() error {
+	return nil
+}
+
+func (d *AWSSSMDecryptor) disableRetries() {
+	d.RetryMaxAttempts = 1
+}
+
+func init() {
+	Register("secretsmanager", func() Decryptor { return NewAWSSecretsManagerDecryptor() })
+	Register("ssm", func() Decryptor { return NewAWSSSMDecryptor() })
+}
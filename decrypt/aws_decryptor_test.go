@@ -0,0 +1,187 @@
+package decrypt
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// Mocked AWS Secrets Manager client
+type mockSecretsManagerClient struct {
+	secrets map[string]string
+}
+
+func (m *mockSecretsManagerClient) GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	value, ok := m.secrets[*params.SecretId]
+	if !ok {
+		return nil, errors.New("ResourceNotFoundException")
+	}
+	return &secretsmanager.GetSecretValueOutput{SecretString: aws.String(value)}, nil
+}
+
+// Mocked AWS Systems Manager client
+type mockSSMClient struct {
+	parameters map[string]string
+}
+
+func (m *mockSSMClient) GetParameter(ctx context.Context, params *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error) {
+	if params.WithDecryption == nil || !*params.WithDecryption {
+		return nil, errors.New("expected a request with decryption")
+	}
+	value, ok := m.parameters[*params.Name]
+	if !ok {
+		return nil, errors.New("ParameterNotFound")
+	}
+	return &ssm.GetParameterOutput{Parameter: &ssmtypes.Parameter{Value: aws.String(value)}}, nil
+}
+
+func TestAWSSecretsManagerDecryptor_Decrypt(t *testing.T) {
+	decryptor := NewAWSSecretsManagerDecryptor()
+	decryptor.client = &mockSecretsManagerClient{secrets: map[string]string{
+		"prod/token": "t0ken",
+		"prod/db":    `{"username":"app","password":"s3cr3t","port":5432}`,
+	}}
+
+	tests := map[string]string{
+		"prod/token":       "t0ken",
+		"prod/db#password": "s3cr3t",
+		"prod/db#port":     "5432",
+	}
+	for name, expected := range tests {
+		value, err := decryptor.Decrypt(name)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+			continue
+		}
+		if value != expected {
+			t.Errorf("%s: expected %q, got %q", name, expected, value)
+		}
+	}
+
+	errorTests := map[string]string{
+		"prod/missing":  "ResourceNotFoundException",
+		"prod/db#host":  `has no key "host"`,
+		"prod/token#id": "is not a JSON object",
+	}
+	for name, expected := range errorTests {
+		_, err := decryptor.Decrypt(name)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: expected an error containing %q, got %v", name, expected, err)
+		}
+	}
+}
+
+func TestAWSSSMDecryptor_Decrypt(t *testing.T) {
+	decryptor := NewAWSSSMDecryptor()
+	decryptor.client = &mockSSMClient{parameters: map[string]string{"/prod/db/password": "s3cr3t"}}
+
+	value, err := decryptor.Decrypt("/prod/db/password")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if value != "s3cr3t" {
+		t.Errorf("expected %q, got %q", "s3cr3t", value)
+	}
+
+	if _, err := decryptor.Decrypt("/prod/missing"); err == nil || !strings.Contains(err.Error(), "ParameterNotFound") {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+}
+
+// setAWSTestEnv configures static credentials, so no real AWS config is used.
+func setAWSTestEnv(t *testing.T) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("AWS_REGION", "eu-central-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_ENDPOINT_URL", "")
+}
+
+func TestAWSDecryptors_Endpoint(t *testing.T) {
+	setAWSTestEnv(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		switch r.Header.Get("X-Amz-Target") {
+		case "secretsmanager.GetSecretValue":
+			if !strings.Contains(string(body), `"SecretId":"prod/db"`) {
+				t.Errorf("unexpected request %s", body)
+			}
+			w.Write([]byte(`{"Name":"prod/db","SecretString":"{\"password\":\"s3cr3t\"}"}`))
+		case "AmazonSSM.GetParameter":
+			if !strings.Contains(string(body), `"WithDecryption":true`) {
+				t.Errorf("unexpected request %s", body)
+			}
+			w.Write([]byte(`{"Parameter":{"Name":"/prod/token","Type":"SecureString","Value":"t0ken"}}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	secretsManager := NewAWSSecretsManagerDecryptor()
+	secretsManager.Endpoint = server.URL
+	if err := secretsManager.Init(); err != nil {
+		t.Fatalf("Init returned error: %v", err)
+	}
+	value, err := secretsManager.Decrypt("prod/db#password")
+	if err != nil || value != "s3cr3t" {
+		t.Errorf("expected s3cr3t, got %q, %v", value, err)
+	}
+
+	t.Setenv("DINGO_AWS_SSM_ENDPOINT", server.URL)
+	parameters := NewAWSSSMDecryptor()
+	if err := parameters.Init(); err != nil {
+		t.Fatalf("Init returned error: %v", err)
+	}
+	value, err = parameters.Decrypt("/prod/token")
+	if err != nil || value != "t0ken" {
+		t.Errorf("expected t0ken, got %q, %v", value, err)
+	}
+}
+
+func TestAWSDecryptors_Policy(t *testing.T) {
+	setAWSTestEnv(t)
+
+	// The SDK retries are turned off, only the policy retries
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"__type":"ServiceUnavailable","message":"try again"}`))
+	}))
+	defer server.Close()
+
+	decryptor := NewAWSSSMDecryptor()
+	decryptor.Endpoint = server.URL
+	policy := CallPolicy{Retries: 2, Backoff: time.Millisecond}
+	d := WithPolicy(decryptor, policy)
+	if decryptor.RetryMaxAttempts != 1 {
+		t.Errorf("expected WithPolicy to turn off the SDK retries, got %d attempts", decryptor.RetryMaxAttempts)
+	}
+	if err := d.InitContext(context.Background()); err != nil {
+		t.Fatalf("Init returned error: %v", err)
+	}
+
+	_, err := d.DecryptContext(context.Background(), "/prod/token")
+	if !IsTransient(err) {
+		t.Errorf("expected a transient error, got %v", err)
+	}
+	if n := requests.Load(); n != 3 {
+		t.Errorf("expected 3 requests, got %d", n)
+	}
+}
@@ -0,0 +1,218 @@
+package decrypt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// ContextDecryptor is the context aware version of Decryptor. The context
+// bounds and cancels every call; Close releases the resources of the
+// decryptor, such as clients and plugin processes. Decryptors that are not
+// context aware are adapted by WithContext.
+type ContextDecryptor interface {
+	InitContext(ctx context.Context) error
+	DecryptContext(ctx context.Context, secretName string) (string, error)
+	Close() error
+}
+
+// WithContext returns d as ContextDecryptor. Decryptors implementing
+// ContextDecryptor are returned as they are. For any other decryptor a call
+// returns as soon as the context is done, while the call itself runs on in the
+// background; Close closes d if it is an io.Closer.
+func WithContext(d Decryptor) ContextDecryptor {
+	if cd, ok := d.(ContextDecryptor); ok {
+		return cd
+	}
+	return &contextAdapter{decryptor: d}
+}
+
+// contextAdapter adapts a Decryptor to ContextDecryptor.
+type contextAdapter struct {
+	decryptor Decryptor
+}
+
+func (a *contextAdapter) InitContext(ctx context.Context) error {
+	_, err := callWithContext(ctx, func() (string, error) {
+		return "", a.decryptor.Init()
+	})
+	return err
+}
+
+func (a *contextAdapter) DecryptContext(ctx context.Context, secretName string) (string, error) {
+	return callWithContext(ctx, func() (string, error) {
+		return a.decryptor.Decrypt(secretName)
+	})
+}
+
+func (a *contextAdapter) Close() error {
+	if closer, ok := a.decryptor.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// callWithContext runs call and returns its result, or the context error once
+// ctx is done.
+func callWithContext(ctx context.Context, call func() (string, error)) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	type result struct {
+		value string
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		value, err := call()
+		done <- result{value, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.value, r.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// transientError marks an error as transient, see Transient.
+type transientError struct {
+	err error
+}
+
+func (e *transientError) Error() string {
+	return e.err.Error()
+}
+
+func (e *transientError) Unwrap() error {
+	return e.err
+}
+
+// Transient marks err as transient: the call failed for a reason that may go
+// away, such as an unavailable or rate limiting backend, and is worth
+// retrying. The error message is unchanged.
+func Transient(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &transientError{err: err}
+}
+
+// IsTransient reports whether err is worth retrying: it is marked with
+// Transient, is a network timeout or a call ran into its deadline.
+func IsTransient(err error) bool {
+	var transient *transientError
+	if errors.As(err, &transient) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+// CallPolicy bounds and retries the calls of a ContextDecryptor, see
+// WithPolicy.
+type CallPolicy struct {
+	// Timeout bounds every single call, there is no limit if it is zero.
+	Timeout time.Duration
+	// Retries is how often a call failing with a transient error is
+	// retried.
+	Retries int
+	// Backoff is the wait before the first retry. It doubles for every
+	// further retry, up to MaxBackoff if that is set.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// DefaultCallPolicy is the call policy used unless configured otherwise.
+var DefaultCallPolicy = CallPolicy{
+	Timeout:    30 * time.Second,
+	Retries:    3,
+	Backoff:    250 * time.Millisecond,
+	MaxBackoff: 5 * time.Second,
+}
+
+// WithPolicy returns d with every Init and Decrypt call bounded by the
+// timeout of policy, and retried with backoff while it fails with a transient
+// error. The error of the last attempt is returned as it is. Decryptors whose
+// clients retry on their own have these retries turned off, so it must be
+// called before Init.
+func WithPolicy(d ContextDecryptor, policy CallPolicy) ContextDecryptor {
+	if r, ok := d.(selfRetrying); ok {
+		r.disableRetries()
+	}
+	return &policyDecryptor{decryptor: d, policy: policy}
+}
+
+// selfRetrying is implemented by decryptors whose clients retry failed calls,
+// such as the Google Cloud and AWS SDK clients.
+type selfRetrying interface {
+	disableRetries()
+}
+
+// policyDecryptor applies a CallPolicy to a ContextDecryptor.
+type policyDecryptor struct {
+	decryptor ContextDecryptor
+	policy    CallPolicy
+}
+
+func (p *policyDecryptor) InitContext(ctx context.Context) error {
+	_, err := p.policy.call(ctx, func(ctx context.Context) (string, error) {
+		return "", p.decryptor.InitContext(ctx)
+	})
+	return err
+}
+
+func (p *policyDecryptor) DecryptContext(ctx context.Context, secretName string) (string, error) {
+	return p.policy.call(ctx, func(ctx context.Context) (string, error) {
+		return p.decryptor.DecryptContext(ctx, secretName)
+	})
+}
+
+func (p *policyDecryptor) Close() error {
+	return p.decryptor.Close()
+}
+
+// call runs call with the timeout of the policy, retrying it while it fails
+// with a transient error and ctx is not done.
+func (p CallPolicy) call(ctx context.Context, call func(ctx context.Context) (string, error)) (string, error) {
+	backoff := p.Backoff
+	for attempt := 0; ; attempt++ {
+		callCtx, cancel := ctx, context.CancelFunc(func() {})
+		if p.Timeout > 0 {
+			callCtx, cancel = context.WithTimeout(ctx, p.Timeout)
+		}
+		value, err := call(callCtx)
+		timedOut := callCtx.Err() != nil && ctx.Err() == nil
+		cancel()
+
+		if err == nil || ctx.Err() != nil {
+			return value, err
+		}
+		if timedOut && errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("%w, timeout %s", err, p.Timeout)
+		}
+		if attempt >= p.Retries || !IsTransient(err) {
+			return "", err
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return "", ctx.Err()
+		case <-timer.C:
+		}
+		backoff *= 2
+		if p.MaxBackoff > 0 {
+			backoff = min(backoff, p.MaxBackoff)
+		}
+	}
+}
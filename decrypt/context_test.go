@@ -0,0 +1,182 @@
+package decrypt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyDecryptor fails with err the first failures calls, and blocks until
+// the context is done for secrets called hang.
+type flakyDecryptor struct {
+	mu       sync.Mutex
+	failures int
+	err      error
+	calls    int
+	closed   bool
+}
+
+func (d *flakyDecryptor) InitContext(ctx context.Context) error {
+	return nil
+}
+
+func (d *flakyDecryptor) DecryptContext(ctx context.Context, secretName string) (string, error) {
+	d.mu.Lock()
+	d.calls++
+	calls := d.calls
+	d.mu.Unlock()
+
+	if secretName == "hang" {
+		<-ctx.Done()
+		return "", fmt.Errorf("failed to read %s: %w", secretName, ctx.Err())
+	}
+	if calls <= d.failures {
+		return "", d.err
+	}
+	return "value of " + secretName, nil
+}
+
+func (d *flakyDecryptor) Close() error {
+	d.closed = true
+	return nil
+}
+
+// blockingDecryptor is a Decryptor whose Decrypt blocks until released.
+type blockingDecryptor struct {
+	release chan struct{}
+	closed  bool
+}
+
+func (d *blockingDecryptor) Init() error {
+	return nil
+}
+
+func (d *blockingDecryptor) Decrypt(secretName string) (string, error) {
+	<-d.release
+	return "value of " + secretName, nil
+}
+
+func (d *blockingDecryptor) Close() error {
+	d.closed = true
+	return nil
+}
+
+func TestWithContext(t *testing.T) {
+	google := NewGoogleDecryptor()
+	if WithContext(google) != ContextDecryptor(google) {
+		t.Error("expected context aware decryptors to be returned as they are")
+	}
+
+	d := &blockingDecryptor{release: make(chan struct{})}
+	adapted := WithContext(d)
+	if err := adapted.InitContext(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	if _, err := adapted.DecryptContext(ctx, "db"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the call to be canceled, got %v", err)
+	}
+
+	close(d.release)
+	value, err := adapted.DecryptContext(context.Background(), "db")
+	if err != nil || value != "value of db" {
+		t.Errorf("expected the value of db, got %q, %v", value, err)
+	}
+
+	if err := adapted.Close(); err != nil || !d.closed {
+		t.Errorf("expected Close to close the decryptor, got %v", err)
+	}
+	if err := WithContext(NewExampleDecryptor()).Close(); err != nil {
+		t.Errorf("expected Close to do nothing, got %v", err)
+	}
+}
+
+func TestWithPolicy_Retry(t *testing.T) {
+	policy := CallPolicy{Retries: 3, Backoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}
+
+	d := &flakyDecryptor{failures: 2, err: Transient(errors.New("unavailable"))}
+	value, err := WithPolicy(d, policy).DecryptContext(context.Background(), "db")
+	if err != nil || value != "value of db" {
+		t.Errorf("expected the value of db, got %q, %v", value, err)
+	}
+	if d.calls != 3 {
+		t.Errorf("expected 3 calls, got %d", d.calls)
+	}
+
+	// The error of the last attempt is returned as it is
+	d = &flakyDecryptor{failures: 10, err: Transient(errors.New("unavailable"))}
+	_, err = WithPolicy(d, policy).DecryptContext(context.Background(), "db")
+	if err == nil || err.Error() != "unavailable" {
+		t.Errorf("expected the transient error, got %v", err)
+	}
+	if d.calls != 4 {
+		t.Errorf("expected 4 calls, got %d", d.calls)
+	}
+
+	d = &flakyDecryptor{failures: 10, err: errors.New("permission denied")}
+	_, err = WithPolicy(d, policy).DecryptContext(context.Background(), "db")
+	if err == nil || err.Error() != "permission denied" || d.calls != 1 {
+		t.Errorf("expected a single call failing with permission denied, got %d calls and %v", d.calls, err)
+	}
+
+	if err := WithPolicy(d, policy).Close(); err != nil || !d.closed {
+		t.Errorf("expected Close to close the decryptor, got %v", err)
+	}
+}
+
+func TestWithPolicy_Timeout(t *testing.T) {
+	d := &flakyDecryptor{}
+	policy := CallPolicy{Timeout: 10 * time.Millisecond, Retries: 1, Backoff: time.Millisecond}
+
+	_, err := WithPolicy(d, policy).DecryptContext(context.Background(), "hang")
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "timeout 10ms") {
+		t.Errorf("expected a timeout error, got %v", err)
+	}
+	// Timeouts are retried
+	if d.calls != 2 {
+		t.Errorf("expected 2 calls, got %d", d.calls)
+	}
+}
+
+func TestWithPolicy_Cancel(t *testing.T) {
+	d := &flakyDecryptor{failures: 10, err: Transient(errors.New("unavailable"))}
+	policy := CallPolicy{Retries: 10, Backoff: time.Hour}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	// Cancellation ends the backoff
+	_, err := WithPolicy(d, policy).DecryptContext(ctx, "db")
+	if !errors.Is(err, context.Canceled) || d.calls != 1 {
+		t.Errorf("expected the call to be canceled after one attempt, got %d calls and %v", d.calls, err)
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	tests := map[error]bool{
+		errors.New("not found"):                              false,
+		Transient(errors.New("unavailable")):                 true,
+		fmt.Errorf("wrapped: %w", Transient(errors.New(""))): true,
+		context.DeadlineExceeded:                             true,
+		context.Canceled:                                     false,
+	}
+	for err, expected := range tests {
+		if IsTransient(err) != expected {
+			t.Errorf("%v: expected IsTransient %t", err, expected)
+		}
+	}
+	if Transient(nil) != nil {
+		t.Error("expected Transient(nil) to be nil")
+	}
+}
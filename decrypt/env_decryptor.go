@@ -0,0 +1,51 @@
+package decrypt
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// EnvPrefix is the prefix of the environment variables EnvDecryptor reads.
+const EnvPrefix = "DINGO_SECRET_"
+
+// EnvDecryptor reads secrets from DINGO_SECRET_* environment variables. The
+// secret name is upper-cased and every character other than a letter or digit
+// becomes an underscore, e.g. db-password is read from
+// DINGO_SECRET_DB_PASSWORD.
+type EnvDecryptor struct{}
+
+func NewEnvDecryptor() *EnvDecryptor {
+	return &EnvDecryptor{}
+}
+
+func (d *EnvDecryptor) Init() error {
+	return nil
+}
+
+func (d *EnvDecryptor) Decrypt(secretName string) (string, error) {
+	key := EnvVariable(secretName)
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return "", fmt.Errorf("secret %s not found, %s is not set", secretName, key)
+	}
+	return value, nil
+}
+
+// EnvVariable returns the environment variable EnvDecryptor reads secretName
+// from.
+func EnvVariable(secretName string) string {
+	return EnvPrefix + strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, secretName)
+}
+
+func init() {
+	Register("env", func() Decryptor { return NewEnvDecryptor() })
+}
@@ -0,0 +1,34 @@
+package decrypt
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEnvDecryptor_Decrypt(t *testing.T) {
+	t.Setenv("DINGO_SECRET_DB_PASSWORD", "s3cr3t")
+	t.Setenv("DINGO_SECRET_EMPTY", "")
+
+	decryptor := NewEnvDecryptor()
+	if err := decryptor.Init(); err != nil {
+		t.Fatalf("Init returned error: %v", err)
+	}
+
+	tests := map[string]string{
+		"db-password": "s3cr3t",
+		"db.password": "s3cr3t",
+		"DB_PASSWORD": "s3cr3t",
+		"empty":       "",
+	}
+	for name, expected := range tests {
+		value, err := decryptor.Decrypt(name)
+		if err != nil || value != expected {
+			t.Errorf("%s: expected %q, got %q, %v", name, expected, value, err)
+		}
+	}
+
+	_, err := decryptor.Decrypt("missing")
+	if err == nil || !strings.Contains(err.Error(), "DINGO_SECRET_MISSING is not set") {
+		t.Errorf("expected a not set error, got %v", err)
+	}
+}
@@ -13,3 +13,7 @@ func (d *ExampleDecryptor) Decrypt(secretName string) (string, error) {
 	// Here, we'll just return a dummy value for demonstration
 	return "decryptedValue", nil
 }
+
+func init() {
+	Register("example", func() Decryptor { return NewExampleDecryptor() })
+}
@@ -0,0 +1,127 @@
+package decrypt
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/subosito/gotenv"
+)
+
+// FileDecryptor reads secrets from local files, to render realistic output
+// during development without access to the real secret store. Path is either
+// a directory holding one file per secret, named by the secret name, e.g.
+// db/password, or a YAML, JSON or dotenv file mapping secret names to values.
+// Nested maps are addressed with dotted names, e.g. db.password.
+type FileDecryptor struct {
+	// Path is the secrets directory or file. Defaults to DINGO_SECRETS_PATH.
+	Path string
+
+	// secrets holds the secrets of a secrets file, nil for a directory.
+	secrets map[string]any
+}
+
+func NewFileDecryptor() *FileDecryptor {
+	return &FileDecryptor{}
+}
+
+// Init reads the secrets file, or checks that the secrets directory exists.
+func (d *FileDecryptor) Init() error {
+	setFromEnv(&d.Path, "DINGO_SECRETS_PATH")
+	if len(d.Path) == 0 {
+		return fmt.Errorf("no secrets path, set DINGO_SECRETS_PATH")
+	}
+
+	info, err := os.Stat(d.Path)
+	if err != nil {
+		return fmt.Errorf("failed to read secrets path: %w", err)
+	}
+	if info.IsDir() {
+		return nil
+	}
+
+	content, err := os.ReadFile(d.Path)
+	if err != nil {
+		return fmt.Errorf("failed to read secrets file: %w", err)
+	}
+	switch ext := strings.ToLower(filepath.Ext(d.Path)); ext {
+	case ".env":
+		env, err := gotenv.StrictParse(bytes.NewReader(content))
+		if err != nil {
+			return fmt.Errorf("failed to parse secrets file %s: %w", d.Path, err)
+		}
+		d.secrets = make(map[string]any, len(env))
+		for key, value := range env {
+			d.secrets[key] = value
+		}
+	case ".yaml", ".yml", ".json":
+		if err := yaml.Unmarshal(content, &d.secrets); err != nil {
+			return fmt.Errorf("failed to parse secrets file %s: %w", d.Path, err)
+		}
+		if d.secrets == nil {
+			d.secrets = map[string]any{}
+		}
+	default:
+		return fmt.Errorf("unsupported secrets file %s, expected a directory or a .yaml, .yml, .json or .env file", d.Path)
+	}
+	return nil
+}
+
+func (d *FileDecryptor) Decrypt(secretName string) (string, error) {
+	if d.secrets == nil {
+		return d.readSecretFile(secretName)
+	}
+
+	value, ok := lookupSecret(d.secrets, secretName)
+	if !ok {
+		return "", fmt.Errorf("secret %s not found in %s", secretName, d.Path)
+	}
+	switch value.(type) {
+	case map[string]any, []any:
+		return "", fmt.Errorf("secret %s in %s is not a single value", secretName, d.Path)
+	case nil:
+		return "", nil
+	}
+	return fmt.Sprint(value), nil
+}
+
+// readSecretFile returns the content of the file called secretName in the
+// secrets directory, without a trailing newline.
+func (d *FileDecryptor) readSecretFile(secretName string) (string, error) {
+	if !filepath.IsLocal(secretName) {
+		return "", fmt.Errorf("secret name %s must be a relative path within %s", secretName, d.Path)
+	}
+	content, err := os.ReadFile(filepath.Join(d.Path, secretName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("secret %s not found in %s", secretName, d.Path)
+		}
+		return "", fmt.Errorf("failed to read secret %s: %w", secretName, err)
+	}
+	value := strings.TrimSuffix(string(content), "\n")
+	return strings.TrimSuffix(value, "\r"), nil
+}
+
+// lookupSecret returns the value of name in secrets. Names that are not a key
+// of secrets are looked up as dotted path into nested maps.
+func lookupSecret(secrets map[string]any, name string) (any, bool) {
+	if value, ok := secrets[name]; ok {
+		return value, true
+	}
+	key, rest, ok := strings.Cut(name, ".")
+	if !ok {
+		return nil, false
+	}
+	nested, ok := secrets[key].(map[string]any)
+	if !ok {
+		return nil, false
+	}
+	return lookupSecret(nested, rest)
+}
+
+func init() {
+	Register("file", func() Decryptor { return NewFileDecryptor() })
+}
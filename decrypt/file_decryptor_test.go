@@ -0,0 +1,139 @@
+package decrypt
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeSecretFile writes content to path, creating its directory.
+func writeSecretFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+}
+
+func TestFileDecryptor_Directory(t *testing.T) {
+	dir := t.TempDir()
+	writeSecretFile(t, filepath.Join(dir, "token"), "t0ken\n")
+	writeSecretFile(t, filepath.Join(dir, "db", "password"), "s3cr3t")
+	t.Setenv("DINGO_SECRETS_PATH", dir)
+
+	decryptor := NewFileDecryptor()
+	if err := decryptor.Init(); err != nil {
+		t.Fatalf("Init returned error: %v", err)
+	}
+
+	tests := map[string]string{
+		"token":       "t0ken",
+		"db/password": "s3cr3t",
+	}
+	for name, expected := range tests {
+		value, err := decryptor.Decrypt(name)
+		if err != nil || value != expected {
+			t.Errorf("%s: expected %q, got %q, %v", name, expected, value, err)
+		}
+	}
+
+	errorTests := map[string]string{
+		"missing":          "secret missing not found",
+		"../outside":       "must be a relative path",
+		"/etc/passwd":      "must be a relative path",
+		"db/../../outside": "must be a relative path",
+	}
+	for name, expected := range errorTests {
+		_, err := decryptor.Decrypt(name)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: expected an error containing %q, got %v", name, expected, err)
+		}
+	}
+}
+
+func TestFileDecryptor_Files(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"secrets.yaml": "token: t0ken\nport: 5432\ndb:\n  password: s3cr3t\n  hosts: [a, b]\n",
+		"secrets.json": `{"token": "t0ken", "port": 5432, "db": {"password": "s3cr3t", "hosts": ["a", "b"]}}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		writeSecretFile(t, path, content)
+
+		decryptor := NewFileDecryptor()
+		decryptor.Path = path
+		if err := decryptor.Init(); err != nil {
+			t.Fatalf("%s: Init returned error: %v", name, err)
+		}
+
+		tests := map[string]string{
+			"token":       "t0ken",
+			"port":        "5432",
+			"db.password": "s3cr3t",
+		}
+		for secret, expected := range tests {
+			value, err := decryptor.Decrypt(secret)
+			if err != nil || value != expected {
+				t.Errorf("%s: %s: expected %q, got %q, %v", name, secret, expected, value, err)
+			}
+		}
+
+		errorTests := map[string]string{
+			"missing":  "secret missing not found",
+			"db.user":  "secret db.user not found",
+			"db":       "is not a single value",
+			"db.hosts": "is not a single value",
+		}
+		for secret, expected := range errorTests {
+			_, err := decryptor.Decrypt(secret)
+			if err == nil || !strings.Contains(err.Error(), expected) {
+				t.Errorf("%s: %s: expected an error containing %q, got %v", name, secret, expected, err)
+			}
+		}
+	}
+}
+
+func TestFileDecryptor_Dotenv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	writeSecretFile(t, path, "DB_PASSWORD=s3cr3t\nTOKEN=\"t0ken\"\n")
+
+	decryptor := NewFileDecryptor()
+	decryptor.Path = path
+	if err := decryptor.Init(); err != nil {
+		t.Fatalf("Init returned error: %v", err)
+	}
+	value, err := decryptor.Decrypt("TOKEN")
+	if err != nil || value != "t0ken" {
+		t.Errorf("expected t0ken, got %q, %v", value, err)
+	}
+	if _, err := decryptor.Decrypt("MISSING"); err == nil {
+		t.Error("expected an error for an unknown secret, but got nil")
+	}
+}
+
+func TestFileDecryptor_Init(t *testing.T) {
+	t.Setenv("DINGO_SECRETS_PATH", "")
+	if err := NewFileDecryptor().Init(); err == nil || !strings.Contains(err.Error(), "no secrets path") {
+		t.Errorf("expected a missing path error, got %v", err)
+	}
+
+	dir := t.TempDir()
+	tests := map[string]string{
+		filepath.Join(dir, "missing"):      "failed to read secrets path",
+		filepath.Join(dir, "secrets.toml"): "unsupported secrets file",
+		filepath.Join(dir, "broken.yaml"):  "failed to parse secrets file",
+	}
+	writeSecretFile(t, filepath.Join(dir, "secrets.toml"), "token = \"t0ken\"\n")
+	writeSecretFile(t, filepath.Join(dir, "broken.yaml"), "token: [\n")
+	for path, expected := range tests {
+		decryptor := NewFileDecryptor()
+		decryptor.Path = path
+		if err := decryptor.Init(); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: expected an error containing %q, got %v", path, expected, err)
+		}
+	}
+}
@@ -7,6 +7,8 @@ import (
 	secretmanager "cloud.google.com/go/secretmanager/apiv1"
 	secretmanagerpb "cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
 	"github.com/googleapis/gax-go/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type SecretManagerClient interface {
@@ -16,6 +18,9 @@ type SecretManagerClient interface {
 
 type GoogleDecryptor struct {
 	client SecretManagerClient
+	// callOptions are passed on every call, WithPolicy turns the retries of
+	// the client off with them.
+	callOptions []gax.CallOption
 }
 
 func NewGoogleDecryptor() *GoogleDecryptor {
@@ -23,10 +28,13 @@ func NewGoogleDecryptor() *GoogleDecryptor {
 }
 
 func (d *GoogleDecryptor) Init() error {
-	ctx := context.Background()
+	return d.InitContext(context.Background())
+}
 
-	// Create the Secret Manager client using ADC
-	client, err := secretmanager.NewClient(ctx)
+func (d *GoogleDecryptor) InitContext(ctx context.Context) error {
+	// Create the Secret Manager client using ADC. The client keeps the
+	// context for its connection, so it must outlive a bounded Init call.
+	client, err := secretmanager.NewClient(context.WithoutCancel(ctx))
 	if err != nil {
 		return fmt.Errorf("failed to create secretmanager client: %w", err)
 	}
@@ -36,18 +44,44 @@ func (d *GoogleDecryptor) Init() error {
 }
 
 func (d *GoogleDecryptor) Decrypt(secretName string) (string, error) {
-	ctx := context.Background()
+	return d.DecryptContext(context.Background(), secretName)
+}
 
+func (d *GoogleDecryptor) DecryptContext(ctx context.Context, secretName string) (string, error) {
 	accessRequest := &secretmanagerpb.AccessSecretVersionRequest{
 		Name: secretName,
 	}
 
-	result, err := d.client.AccessSecretVersion(ctx, accessRequest)
+	result, err := d.client.AccessSecretVersion(ctx, accessRequest, d.callOptions...)
 	if err != nil {
-		return "", fmt.Errorf("failed to access secret version: %w", err)
+		code := status.Code(err)
+		err = fmt.Errorf("failed to access secret version: %w", err)
+		switch code {
+		case codes.Unavailable, codes.ResourceExhausted, codes.Aborted, codes.Internal:
+			return "", Transient(err)
+		}
+		return "", err
 	}
 
 	secretData := string(result.Payload.Data)
 
 	return secretData, nil
 }
+
+// Close closes the Secret Manager client.
+func (d *GoogleDecryptor) Close() error {
+	if d.client == nil {
+		return nil
+	}
+	err := d.client.Close()
+	d.client = nil
+	return err
+}
+
+func (d *GoogleDecryptor) disableRetries() {
+	d.callOptions = append(d.callOptions, gax.WithRetry(nil))
+}
+
+func init() {
+	Register("google", func() Decryptor { return NewGoogleDecryptor() })
+}
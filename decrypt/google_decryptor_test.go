@@ -3,9 +3,13 @@ package decrypt
 import (
 	"context"
 	"errors"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/googleapis/gax-go/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	secretmanagerpb "cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
 )
@@ -72,3 +76,60 @@ func TestGoogleDecryptor_Decrypt_Error(t *testing.T) {
 		t.Fatal("Decrypt() error = nil, want error")
 	}
 }
+
+func TestGoogleDecryptor_Close(t *testing.T) {
+	closed := 0
+	decryptor := NewGoogleDecryptor()
+	decryptor.client = &mockSecretManagerClient{closeFunc: func() error {
+		closed++
+		return nil
+	}}
+
+	if err := decryptor.Close(); err != nil {
+		t.Fatalf("Close() error = %v, want nil", err)
+	}
+	if err := decryptor.Close(); err != nil {
+		t.Fatalf("Close() error = %v, want nil", err)
+	}
+	if closed != 1 {
+		t.Errorf("client closed %d times, want 1", closed)
+	}
+}
+
+// retryingSecretManagerClient is an always unavailable Secret Manager client
+// that retries like the real client does by default, unless the call options
+// say otherwise, and counts the attempts.
+type retryingSecretManagerClient struct {
+	attempts atomic.Int32
+}
+
+func (m *retryingSecretManagerClient) AccessSecretVersion(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest, opts ...gax.CallOption) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+	defaults := []gax.CallOption{gax.WithRetry(func() gax.Retryer {
+		return gax.OnCodes([]codes.Code{codes.Unavailable}, gax.Backoff{Initial: time.Millisecond, Max: time.Millisecond})
+	})}
+	err := gax.Invoke(ctx, func(ctx context.Context, settings gax.CallSettings) error {
+		m.attempts.Add(1)
+		return status.Error(codes.Unavailable, "unavailable")
+	}, append(defaults, opts...)...)
+	return nil, err
+}
+
+func (m *retryingSecretManagerClient) Close() error {
+	return nil
+}
+
+func TestGoogleDecryptor_Policy(t *testing.T) {
+	client := &retryingSecretManagerClient{}
+	decryptor := NewGoogleDecryptor()
+	decryptor.client = client
+
+	// The client retries are turned off, only the policy retries
+	policy := CallPolicy{Timeout: time.Second, Retries: 2, Backoff: time.Millisecond}
+	_, err := WithPolicy(decryptor, policy).DecryptContext(context.Background(), "projects/p/secrets/s/versions/latest")
+	if !IsTransient(err) || status.Code(err) != codes.Unavailable {
+		t.Errorf("expected a transient unavailable error, got %v", err)
+	}
+	if n := client.attempts.Load(); n != 3 {
+		t.Errorf("expected 3 attempts, got %d", n)
+	}
+}
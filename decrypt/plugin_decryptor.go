@@ -0,0 +1,176 @@
+package decrypt
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+)
+
+// PluginRequest is a request sent to a decryptor plugin, one JSON object per
+// line on its stdin. Method is "init" or "decrypt"; Secret is the name of the
+// secret to decrypt.
+type PluginRequest struct {
+	Method string `json:"method"`
+	Secret string `json:"secret,omitempty"`
+}
+
+// PluginResponse is the answer of a decryptor plugin to a request, one JSON
+// object per line on its stdout. Error is set if the request failed.
+type PluginResponse struct {
+	Value string `json:"value,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// PluginDecryptor runs an external executable as decryptor. The executable is
+// started once and answers PluginRequests in order until its stdin is closed.
+// Its stderr is passed through.
+type PluginDecryptor struct {
+	path string
+	args []string
+
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	// initialised is set by Init, a plugin killed afterwards is restarted
+	// by the next call.
+	initialised bool
+}
+
+func NewPluginDecryptor(path string, args ...string) *PluginDecryptor {
+	return &PluginDecryptor{path: path, args: args}
+}
+
+// Init starts the plugin if it is not running yet and sends it an init
+// request.
+func (d *PluginDecryptor) Init() error {
+	return d.InitContext(context.Background())
+}
+
+func (d *PluginDecryptor) InitContext(ctx context.Context) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.init(ctx); err != nil {
+		return err
+	}
+	d.initialised = true
+	return nil
+}
+
+func (d *PluginDecryptor) Decrypt(secretName string) (string, error) {
+	return d.DecryptContext(context.Background(), secretName)
+}
+
+func (d *PluginDecryptor) DecryptContext(ctx context.Context, secretName string) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.initialised {
+		return "", fmt.Errorf("decryptor plugin %s is not initialised", d.path)
+	}
+	if d.cmd == nil {
+		if err := d.init(ctx); err != nil {
+			return "", err
+		}
+	}
+	return d.call(ctx, PluginRequest{Method: "decrypt", Secret: secretName})
+}
+
+// Close closes the stdin of the plugin and waits for it to exit.
+func (d *PluginDecryptor) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.initialised = false
+	if d.cmd == nil {
+		return nil
+	}
+	d.stdin.Close()
+	err := d.cmd.Wait()
+	d.cmd = nil
+	return err
+}
+
+// init starts the plugin if it is not running and sends it an init request.
+func (d *PluginDecryptor) init(ctx context.Context) error {
+	if d.cmd == nil {
+		if err := d.start(); err != nil {
+			return err
+		}
+	}
+	_, err := d.call(ctx, PluginRequest{Method: "init"})
+	return err
+}
+
+func (d *PluginDecryptor) start() error {
+	cmd := exec.Command(d.path, d.args...)
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("failed to start decryptor plugin %s: %w", d.path, err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to start decryptor plugin %s: %w", d.path, err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start decryptor plugin %s: %w", d.path, err)
+	}
+
+	d.cmd = cmd
+	d.stdin = stdin
+	d.stdout = bufio.NewReader(stdout)
+	return nil
+}
+
+// call sends req to the plugin and reads its response. If ctx is done before
+// the plugin answered, the plugin is killed; the next call starts it again.
+func (d *PluginDecryptor) call(ctx context.Context, req PluginRequest) (string, error) {
+	cmd := d.cmd
+	stop := context.AfterFunc(ctx, func() {
+		cmd.Process.Kill()
+	})
+	value, err := d.roundTrip(req)
+	if !stop() {
+		cmd.Wait()
+		d.cmd = nil
+		return "", fmt.Errorf("%s request to decryptor plugin %s: %w", req.Method, d.path, ctx.Err())
+	}
+	return value, err
+}
+
+// roundTrip sends req to the plugin and reads its response.
+func (d *PluginDecryptor) roundTrip(req PluginRequest) (string, error) {
+	content, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	if _, err := d.stdin.Write(append(content, '\n')); err != nil {
+		return "", fmt.Errorf("failed to send %s request to decryptor plugin %s: %w", req.Method, d.path, err)
+	}
+
+	line, err := d.stdout.ReadBytes('\n')
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return "", fmt.Errorf("decryptor plugin %s exited before answering the %s request", d.path, req.Method)
+		}
+		return "", fmt.Errorf("failed to read %s response of decryptor plugin %s: %w", req.Method, d.path, err)
+	}
+
+	var resp PluginResponse
+	if err := json.Unmarshal(line, &resp); err != nil {
+		return "", fmt.Errorf("invalid %s response of decryptor plugin %s: %w", req.Method, d.path, err)
+	}
+	if len(resp.Error) > 0 {
+		return "", errors.New(resp.Error)
+	}
+	return resp.Value, nil
+}
@@ -0,0 +1,128 @@
+package decrypt
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestHelperPlugin is not a real test, it is run as decryptor plugin by the
+// tests below.
+func TestHelperPlugin(t *testing.T) {
+	if os.Getenv("DINGO_TEST_PLUGIN") != "1" {
+		return
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var req PluginRequest
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			encoder.Encode(PluginResponse{Error: err.Error()})
+			continue
+		}
+		switch {
+		case req.Method == "init":
+			encoder.Encode(PluginResponse{})
+		case req.Method == "decrypt" && req.Secret == "exit":
+			os.Exit(0)
+		case req.Method == "decrypt" && req.Secret == "hang":
+			time.Sleep(time.Hour)
+		case req.Method == "decrypt" && req.Secret == "missing":
+			encoder.Encode(PluginResponse{Error: "secret missing not found"})
+		case req.Method == "decrypt":
+			encoder.Encode(PluginResponse{Value: fmt.Sprintf("value of %s", req.Secret)})
+		default:
+			encoder.Encode(PluginResponse{Error: "unknown method " + req.Method})
+		}
+	}
+	os.Exit(0)
+}
+
+func newTestPlugin(t *testing.T) *PluginDecryptor {
+	t.Helper()
+	t.Setenv("DINGO_TEST_PLUGIN", "1")
+	decryptor := NewPluginDecryptor(os.Args[0], "-test.run=^TestHelperPlugin$")
+	t.Cleanup(func() { decryptor.Close() })
+	return decryptor
+}
+
+func TestPluginDecryptor_Decrypt(t *testing.T) {
+	decryptor := newTestPlugin(t)
+
+	if _, err := decryptor.Decrypt("db"); err == nil {
+		t.Error("expected an error before Init, but got nil")
+	}
+
+	// Init can be called repeatedly and reuses the running plugin
+	for range 2 {
+		if err := decryptor.Init(); err != nil {
+			t.Fatalf("Init returned error: %v", err)
+		}
+	}
+
+	for _, name := range []string{"db", "api/token"} {
+		value, err := decryptor.Decrypt(name)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if expected := "value of " + name; value != expected {
+			t.Errorf("expected %q, got %q", expected, value)
+		}
+	}
+
+	_, err := decryptor.Decrypt("missing")
+	if err == nil || err.Error() != "secret missing not found" {
+		t.Errorf("expected the error of the plugin, got %v", err)
+	}
+
+	if err := decryptor.Close(); err != nil {
+		t.Errorf("Close returned error: %v", err)
+	}
+}
+
+func TestPluginDecryptor_Exit(t *testing.T) {
+	decryptor := newTestPlugin(t)
+	if err := decryptor.Init(); err != nil {
+		t.Fatalf("Init returned error: %v", err)
+	}
+
+	_, err := decryptor.Decrypt("exit")
+	if err == nil {
+		t.Fatal("expected an error when the plugin exits, but got nil")
+	}
+}
+
+func TestPluginDecryptor_Cancel(t *testing.T) {
+	decryptor := newTestPlugin(t)
+	if err := decryptor.InitContext(context.Background()); err != nil {
+		t.Fatalf("Init returned error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := decryptor.DecryptContext(ctx, "hang")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a deadline error, got %v", err)
+	}
+
+	// The hanging plugin was killed, the next call starts it again
+	if value, err := decryptor.Decrypt("db"); err != nil || value != "value of db" {
+		t.Errorf("expected the value of db, got %q, %v", value, err)
+	}
+	if err := decryptor.Close(); err != nil {
+		t.Errorf("Close returned error: %v", err)
+	}
+}
+
+func TestPluginDecryptor_StartError(t *testing.T) {
+	decryptor := NewPluginDecryptor("/does/not/exist")
+	if err := decryptor.Init(); err == nil {
+		t.Error("expected an error for a missing executable, but got nil")
+	}
+}
@@ -0,0 +1,90 @@
+package decrypt
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Decryptor resolves the secret references of the data files. Init is called
+// once, Decrypt concurrently afterwards.
+type Decryptor interface {
+	Init() error
+	Decrypt(secretName string) (string, error)
+}
+
+// Factory creates a new, uninitialised decryptor.
+type Factory func() Decryptor
+
+// PluginPrefix is the name prefix of external decryptor executables, see
+// PluginDecryptor.
+const PluginPrefix = "dingo-decryptor-"
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+// Register makes a decryptor available by name. Built-in decryptors register
+// themselves in init. It panics if name is registered twice.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if factory == nil {
+		panic("decrypt: Register factory is nil")
+	}
+	if _, dup := registry[name]; dup {
+		panic("decrypt: Register called twice for decryptor " + name)
+	}
+	registry[name] = factory
+}
+
+// Names returns the names of the registered decryptors, sorted.
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New returns the registered decryptor called name. Unknown names are looked
+// up as a PluginPrefix<name> executable in PATH.
+func New(name string) (Decryptor, error) {
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+	if ok {
+		return factory(), nil
+	}
+
+	path, err := exec.LookPath(PluginPrefix + name)
+	if err != nil {
+		if !errors.Is(err, exec.ErrNotFound) {
+			return nil, fmt.Errorf("failed to look up decryptor plugin %s: %w", PluginPrefix+name, err)
+		}
+		return nil, fmt.Errorf("no such decryptor %q, available values [%s] or a %s%s executable in PATH", name, strings.Join(Names(), ", "), PluginPrefix, name)
+	}
+	return NewPluginDecryptor(path), nil
+}
+
+// Exists reports whether New finds a decryptor called name, registered or as
+// plugin.
+func Exists(name string) bool {
+	registryMu.RLock()
+	_, ok := registry[name]
+	registryMu.RUnlock()
+	if ok {
+		return true
+	}
+	_, err := exec.LookPath(PluginPrefix + name)
+	return err == nil
+}
@@ -0,0 +1,68 @@
+package decrypt
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNew_Registered(t *testing.T) {
+	for _, name := range []string{"example", "google"} {
+		if !slices.Contains(Names(), name) {
+			t.Errorf("expected %s to be registered, got %v", name, Names())
+		}
+	}
+
+	decryptor, err := New("example")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := decryptor.(*ExampleDecryptor); !ok {
+		t.Errorf("expected an ExampleDecryptor, got %T", decryptor)
+	}
+}
+
+func TestNew_Plugin(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("plugin lookup test uses a shell script")
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, PluginPrefix+"test")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatalf("failed to write plugin: %v", err)
+	}
+	t.Setenv("PATH", dir)
+
+	decryptor, err := New("test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	plugin, ok := decryptor.(*PluginDecryptor)
+	if !ok || plugin.path != path {
+		t.Errorf("expected a PluginDecryptor for %s, got %#v", path, decryptor)
+	}
+}
+
+func TestNew_Unknown(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+
+	_, err := New("missing")
+	if err == nil {
+		t.Fatal("expected an error for an unknown decryptor, but got nil")
+	}
+	if !strings.Contains(err.Error(), `no such decryptor "missing"`) || !strings.Contains(err.Error(), PluginPrefix+"missing") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestRegister_Duplicate(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected Register to panic for a duplicate name")
+		}
+	}()
+	Register("example", func() Decryptor { return NewExampleDecryptor() })
+}
@@ -0,0 +1,259 @@
+package decrypt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// VaultDecryptor reads secrets from a HashiCorp Vault KV v2 secrets engine.
+// Secret names address a field of a secret as <mount>/<path>#<field>, e.g.
+// kv/app#password. Mounts spanning several path segments are separated from
+// the path with ::, e.g. secret/team-a/kv::app#password. A ?version=<n> suffix
+// on the path pins a version, e.g. kv/app?version=3#password. The field can
+// be left out for secrets with a single field.
+//
+// Unset fields are read from the environment like the Vault CLI does:
+// VAULT_ADDR, VAULT_NAMESPACE and VAULT_TOKEN, falling back to ~/.vault-token.
+// With VAULT_ROLE_ID and VAULT_SECRET_ID set, it logs in with AppRole
+// instead. VAULT_KV_MOUNT sets the Mount.
+type VaultDecryptor struct {
+	Address   string
+	Namespace string
+	Token     string
+	// RoleID and SecretID are the AppRole credentials, used if there is
+	// no token.
+	RoleID   string
+	SecretID string
+	// AppRoleMount is the mount of the AppRole auth method, approle by
+	// default.
+	AppRoleMount string
+	// Mount is the mount of the KV secrets engine for secret names without
+	// one. If it is empty, the first path segment is the mount.
+	Mount string
+
+	// HTTPClient sends the requests to Vault. If it is nil, Init creates a
+	// client of the decryptor, which Close releases.
+	HTTPClient *http.Client
+	ownClient  bool
+}
+
+func NewVaultDecryptor() *VaultDecryptor {
+	return &VaultDecryptor{}
+}
+
+// Init fills in the configuration from the environment and logs in with
+// AppRole if there is no token.
+func (d *VaultDecryptor) Init() error {
+	return d.InitContext(context.Background())
+}
+
+func (d *VaultDecryptor) InitContext(ctx context.Context) error {
+	setFromEnv(&d.Address, "VAULT_ADDR")
+	setFromEnv(&d.Namespace, "VAULT_NAMESPACE")
+	setFromEnv(&d.RoleID, "VAULT_ROLE_ID")
+	setFromEnv(&d.SecretID, "VAULT_SECRET_ID")
+	setFromEnv(&d.AppRoleMount, "VAULT_APPROLE_MOUNT")
+	setFromEnv(&d.Mount, "VAULT_KV_MOUNT")
+	if len(d.Address) == 0 {
+		d.Address = "https://127.0.0.1:8200"
+	}
+	if len(d.AppRoleMount) == 0 {
+		d.AppRoleMount = "approle"
+	}
+	if d.HTTPClient == nil {
+		d.HTTPClient = &http.Client{Transport: http.DefaultTransport.(*http.Transport).Clone()}
+		d.ownClient = true
+	}
+
+	if len(d.Token) > 0 {
+		return nil
+	}
+	// AppRole credentials take precedence over a token of the user
+	if len(d.RoleID) > 0 {
+		return d.loginAppRole(ctx)
+	}
+	setFromEnv(&d.Token, "VAULT_TOKEN")
+	if len(d.Token) > 0 {
+		return nil
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		if token, err := os.ReadFile(filepath.Join(home, ".vault-token")); err == nil {
+			d.Token = strings.TrimSpace(string(token))
+		}
+	}
+	if len(d.Token) == 0 {
+		return fmt.Errorf("no vault credentials, set VAULT_TOKEN or VAULT_ROLE_ID and VAULT_SECRET_ID")
+	}
+	return nil
+}
+
+func (d *VaultDecryptor) Decrypt(secretName string) (string, error) {
+	return d.DecryptContext(context.Background(), secretName)
+}
+
+func (d *VaultDecryptor) DecryptContext(ctx context.Context, secretName string) (string, error) {
+	// The mount is cut off first, url.Parse would read mount: as a scheme
+	mount, name, ok := strings.Cut(secretName, "::")
+	if !ok {
+		mount, name = d.Mount, secretName
+	}
+	ref, err := url.Parse(name)
+	if err != nil {
+		return "", fmt.Errorf("invalid vault secret %q: %w", secretName, err)
+	}
+	path := strings.Trim(ref.Path, "/")
+	if len(mount) == 0 && !ok {
+		mount, path, _ = strings.Cut(path, "/")
+	}
+	mount = strings.Trim(mount, "/")
+	if len(mount) == 0 || len(path) == 0 {
+		return "", fmt.Errorf("invalid vault secret %q, expected <mount>/<path>#<field> or <mount>::<path>#<field>", secretName)
+	}
+
+	query := url.Values{}
+	if version := ref.Query().Get("version"); len(version) > 0 {
+		if _, err := strconv.Atoi(version); err != nil {
+			return "", fmt.Errorf("invalid version %q of vault secret %q", version, secretName)
+		}
+		query.Set("version", version)
+	}
+
+	var secret struct {
+		Data struct {
+			Data map[string]any `json:"data"`
+		} `json:"data"`
+	}
+	if err := d.request(ctx, http.MethodGet, fmt.Sprintf("/v1/%s/data/%s", mount, path), query, nil, &secret); err != nil {
+		return "", fmt.Errorf("failed to read vault secret %s/%s: %w", mount, path, err)
+	}
+
+	fields := secret.Data.Data
+	field := ref.Fragment
+	if len(field) == 0 {
+		if len(fields) != 1 {
+			return "", fmt.Errorf("vault secret %s/%s has %d fields, select one with #<field>", mount, path, len(fields))
+		}
+		for name := range fields {
+			field = name
+		}
+	}
+
+	value, ok := fields[field]
+	if !ok {
+		return "", fmt.Errorf("vault secret %s/%s has no field %q", mount, path, field)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	content, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// loginAppRole exchanges the AppRole credentials for a token.
+func (d *VaultDecryptor) loginAppRole(ctx context.Context) error {
+	body := map[string]string{"role_id": d.RoleID, "secret_id": d.SecretID}
+	var login struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	if err := d.request(ctx, http.MethodPost, fmt.Sprintf("/v1/auth/%s/login", d.AppRoleMount), nil, body, &login); err != nil {
+		return fmt.Errorf("failed to log in to vault with approle: %w", err)
+	}
+	if len(login.Auth.ClientToken) == 0 {
+		return fmt.Errorf("failed to log in to vault with approle: no token returned")
+	}
+	d.Token = login.Auth.ClientToken
+	return nil
+}
+
+// Close closes the idle connections of the client created by Init.
+func (d *VaultDecryptor) Close() error {
+	if d.ownClient {
+		d.HTTPClient.CloseIdleConnections()
+	}
+	return nil
+}
+
+// request sends a request to the Vault API and decodes the JSON response into
+// out. Network errors and responses of an overloaded or unavailable Vault are
+// transient.
+func (d *VaultDecryptor) request(ctx context.Context, method, path string, query url.Values, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		content, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(content)
+	}
+
+	u := strings.TrimRight(d.Address, "/") + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return err
+	}
+	if len(d.Token) > 0 {
+		req.Header.Set("X-Vault-Token", d.Token)
+	}
+	if len(d.Namespace) > 0 {
+		req.Header.Set("X-Vault-Namespace", d.Namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := d.HTTPClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		return Transient(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Errors []string `json:"errors"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		if resp.StatusCode == http.StatusNotFound && len(apiErr.Errors) == 0 {
+			return fmt.Errorf("not found")
+		}
+		err := fmt.Errorf("vault returned %s", resp.Status)
+		if len(apiErr.Errors) > 0 {
+			err = fmt.Errorf("vault returned %s: %s", resp.Status, strings.Join(apiErr.Errors, ", "))
+		}
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError {
+			return Transient(err)
+		}
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// setFromEnv sets field to the environment variable key, unless it is set.
+func setFromEnv(field *string, key string) {
+	if len(*field) == 0 {
+		*field = os.Getenv(key)
+	}
+}
+
+func init() {
+	Register("vault", func() Decryptor { return NewVaultDecryptor() })
+}
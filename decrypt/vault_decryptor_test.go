@@ -0,0 +1,192 @@
+package decrypt
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newVaultServer returns a stand-in for the Vault API serving KV v2 secrets
+// from the kv and the secret/team-a/kv mounts. Version 1 of kv/app has another password.
+func newVaultServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.URL.Path == "/v1/auth/approle/login" {
+			var login map[string]string
+			json.NewDecoder(r.Body).Decode(&login)
+			if login["role_id"] != "role" || login["secret_id"] != "secret" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"errors":["invalid role or secret ID"]}`))
+				return
+			}
+			w.Write([]byte(`{"auth":{"client_token":"approle-token"}}`))
+			return
+		}
+
+		if token := r.Header.Get("X-Vault-Token"); token != "root" && token != "approle-token" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+
+		switch {
+		case r.URL.Path == "/v1/kv/data/app" && r.URL.Query().Get("version") == "1":
+			w.Write([]byte(`{"data":{"data":{"password":"old"},"metadata":{"version":1}}}`))
+		case r.URL.Path == "/v1/kv/data/app":
+			w.Write([]byte(`{"data":{"data":{"password":"s3cr3t","port":5432},"metadata":{"version":2}}}`))
+		case r.URL.Path == "/v1/kv/data/sealed":
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"errors":["Vault is sealed"]}`))
+		case r.URL.Path == "/v1/kv/data/team/api":
+			w.Write([]byte(`{"data":{"data":{"token":"t0ken"},"metadata":{"version":1}}}`))
+		case r.URL.Path == "/v1/secret/team-a/kv/data/app":
+			w.Write([]byte(`{"data":{"data":{"password":"team-s3cr3t"},"metadata":{"version":1}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[]}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestVaultDecryptor_Decrypt(t *testing.T) {
+	server := newVaultServer(t)
+
+	decryptor := NewVaultDecryptor()
+	decryptor.Address = server.URL
+	decryptor.Token = "root"
+	if err := decryptor.Init(); err != nil {
+		t.Fatalf("Init returned error: %v", err)
+	}
+
+	tests := map[string]string{
+		"kv/app#password":           "s3cr3t",
+		"kv/app?version=1#password": "old",
+		"kv/app#port":               "5432",
+		"kv/team/api":               "t0ken",
+		"secret/team-a/kv::app":     "team-s3cr3t",
+		"secret/team-a/kv/::/app":   "team-s3cr3t",
+		"kv::team/api#token":        "t0ken",
+	}
+	for name, expected := range tests {
+		value, err := decryptor.Decrypt(name)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+			continue
+		}
+		if value != expected {
+			t.Errorf("%s: expected %q, got %q", name, expected, value)
+		}
+	}
+}
+
+func TestVaultDecryptor_DecryptErrors(t *testing.T) {
+	server := newVaultServer(t)
+
+	decryptor := NewVaultDecryptor()
+	decryptor.Address = server.URL
+	decryptor.Token = "root"
+	if err := decryptor.Init(); err != nil {
+		t.Fatalf("Init returned error: %v", err)
+	}
+
+	tests := map[string]string{
+		"kv":                      "expected <mount>/<path>#<field>",
+		"::app#password":          "expected <mount>/<path>#<field>",
+		"kv::":                    "expected <mount>/<path>#<field>",
+		"kv/missing#password":     "failed to read vault secret kv/missing: not found",
+		"kv/app":                  "has 2 fields",
+		"kv/app#user":             `has no field "user"`,
+		"kv/app?version=x#secret": `invalid version "x"`,
+	}
+	for name, expected := range tests {
+		_, err := decryptor.Decrypt(name)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: expected an error containing %q, got %v", name, expected, err)
+		}
+	}
+
+	// An unavailable Vault is worth retrying, a missing secret is not
+	_, err := decryptor.Decrypt("kv/sealed#password")
+	if err == nil || !strings.Contains(err.Error(), "Vault is sealed") || !IsTransient(err) {
+		t.Errorf("expected a transient error, got %v", err)
+	}
+	if _, err := decryptor.Decrypt("kv/missing#password"); IsTransient(err) {
+		t.Errorf("expected a permanent error, got %v", err)
+	}
+
+	decryptor.Token = "wrong"
+	_, err = decryptor.Decrypt("kv/app#password")
+	if err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Errorf("expected a permission error, got %v", err)
+	}
+}
+
+func TestVaultDecryptor_Mount(t *testing.T) {
+	server := newVaultServer(t)
+	t.Setenv("VAULT_KV_MOUNT", "secret/team-a/kv")
+
+	decryptor := NewVaultDecryptor()
+	decryptor.Address = server.URL
+	decryptor.Token = "root"
+	if err := decryptor.Init(); err != nil {
+		t.Fatalf("Init returned error: %v", err)
+	}
+	if decryptor.HTTPClient == http.DefaultClient {
+		t.Error("expected a client of the decryptor, got the default client")
+	}
+
+	// Names without a mount are read from VAULT_KV_MOUNT
+	value, err := decryptor.Decrypt("app#password")
+	if err != nil || value != "team-s3cr3t" {
+		t.Errorf("expected the password of secret/team-a/kv/app, got %q, %v", value, err)
+	}
+	value, err = decryptor.Decrypt("kv::app#password")
+	if err != nil || value != "s3cr3t" {
+		t.Errorf("expected the password of kv/app, got %q, %v", value, err)
+	}
+	if err := decryptor.Close(); err != nil {
+		t.Errorf("Close returned error: %v", err)
+	}
+}
+
+func TestVaultDecryptor_AppRole(t *testing.T) {
+	server := newVaultServer(t)
+	t.Setenv("VAULT_ADDR", server.URL)
+	t.Setenv("VAULT_TOKEN", "")
+	t.Setenv("VAULT_ROLE_ID", "role")
+	t.Setenv("VAULT_SECRET_ID", "secret")
+
+	decryptor := NewVaultDecryptor()
+	if err := decryptor.Init(); err != nil {
+		t.Fatalf("Init returned error: %v", err)
+	}
+	if decryptor.Token != "approle-token" {
+		t.Errorf("expected the approle token, got %q", decryptor.Token)
+	}
+	value, err := decryptor.Decrypt("kv/app#password")
+	if err != nil || value != "s3cr3t" {
+		t.Errorf("expected s3cr3t, got %q, %v", value, err)
+	}
+
+	t.Setenv("VAULT_SECRET_ID", "wrong")
+	err = NewVaultDecryptor().Init()
+	if err == nil || !strings.Contains(err.Error(), "invalid role or secret ID") {
+		t.Errorf("expected a login error, got %v", err)
+	}
+}
+
+func TestVaultDecryptor_NoCredentials(t *testing.T) {
+	t.Setenv("VAULT_TOKEN", "")
+	t.Setenv("VAULT_ROLE_ID", "")
+	t.Setenv("HOME", t.TempDir())
+
+	if err := NewVaultDecryptor().Init(); err == nil {
+		t.Error("expected an error without credentials, but got nil")
+	}
+}
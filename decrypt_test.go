@@ -4,7 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 // dummyDecryptor is a simple implementation of the Decryptor interface.
@@ -121,3 +124,104 @@ func TestDecryptSecrets_Error(t *testing.T) {
 		t.Errorf("expected error %q, got %q", expectedErr, err.Error())
 	}
 }
+
+// countingDecryptor counts Init and Decrypt calls and the most concurrent
+// Decrypt calls. Names starting with error fail.
+type countingDecryptor struct {
+	mu          sync.Mutex
+	inits       int
+	calls       map[string]int
+	inFlight    int
+	maxInFlight int
+}
+
+func (d *countingDecryptor) Init() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.inits++
+	return nil
+}
+
+func (d *countingDecryptor) Decrypt(secretName string) (string, error) {
+	d.mu.Lock()
+	d.calls[secretName]++
+	d.inFlight++
+	d.maxInFlight = max(d.maxInFlight, d.inFlight)
+	d.mu.Unlock()
+
+	time.Sleep(time.Millisecond)
+
+	d.mu.Lock()
+	d.inFlight--
+	d.mu.Unlock()
+	if strings.HasPrefix(secretName, "error") {
+		return "", errors.New(secretName + " failed")
+	}
+	return "value-" + secretName, nil
+}
+
+func TestDecryptSecrets_Deduplicated(t *testing.T) {
+	defer func(previous int) { secretWorkers = previous }(secretWorkers)
+	secretWorkers = 4
+
+	data := Data{}
+	expected := Data{}
+	for i := range 20 {
+		key := fmt.Sprintf("key%d", i)
+		data[key] = Data{"a": fmt.Sprintf("$$s%d$$", i), "b": []any{fmt.Sprintf("x-$$s%d$$-$$s%d$$", i, i)}}
+		expected[key] = Data{"a": fmt.Sprintf("value-s%d", i), "b": []any{fmt.Sprintf("x-value-s%d-value-s%d", i, i)}}
+	}
+
+	decryptor := &countingDecryptor{calls: map[string]int{}}
+	if err := decryptSecrets(&data, decryptor); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(data, expected) {
+		t.Errorf("expected %v, got %v", expected, data)
+	}
+
+	if decryptor.inits != 1 {
+		t.Errorf("expected one Init, got %d", decryptor.inits)
+	}
+	if len(decryptor.calls) != 20 {
+		t.Errorf("expected 20 secrets to be resolved, got %d", len(decryptor.calls))
+	}
+	for name, calls := range decryptor.calls {
+		if calls != 1 {
+			t.Errorf("expected %s to be resolved once, got %d", name, calls)
+		}
+	}
+	if decryptor.maxInFlight > secretWorkers {
+		t.Errorf("expected at most %d concurrent calls, got %d", secretWorkers, decryptor.maxInFlight)
+	}
+}
+
+func TestDecryptSecrets_NoReferences(t *testing.T) {
+	decryptor := &countingDecryptor{calls: map[string]int{}}
+	data := Data{"plain": "value"}
+	if err := decryptSecrets(&data, decryptor); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if decryptor.inits != 0 {
+		t.Errorf("expected no Init without references, got %d", decryptor.inits)
+	}
+}
+
+func TestDecryptSecrets_FirstError(t *testing.T) {
+	defer func(previous int) { secretWorkers = previous }(secretWorkers)
+	secretWorkers = 1
+
+	data := Data{"b": "$$error-b$$", "a": "$$error-a$$", "z": "$$z$$"}
+	decryptor := &countingDecryptor{calls: map[string]int{}}
+	err := decryptSecrets(&data, decryptor)
+	if err == nil || err.Error() != "error-a failed" {
+		t.Errorf("expected the error of error-a, got %v", err)
+	}
+	// No more secrets are requested after a failure
+	if len(decryptor.calls) != 1 {
+		t.Errorf("expected resolution to stop after the failure, got calls %v", decryptor.calls)
+	}
+	if data["z"] != "$$z$$" {
+		t.Errorf("expected the data to be unchanged, got %v", data)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// newExplainCmd returns the command printing where a value of the merged data
+// comes from.
+func newExplainCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "explain <path>",
+		Short: "Shows which data file set a value and which values it overrode",
+		Long: `Shows which data file set a value and which values it overrode.
+
+The path is a dotted key path into the merged data, e.g. network.cidr. For a
+map every value below it is explained.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			_, prov, err := loadAndTrackYAMLFiles(basePath, overlayPaths...)
+			if err != nil {
+				logger.Error("failed to load YAML files",
+					zap.Error(err),
+					zap.String("basePath", basePath),
+					zap.Strings("overlayPaths", overlayPaths),
+				)
+				os.Exit(1)
+			}
+
+			if err := prov.explain(cmd.OutOrStdout(), args[0]); err != nil {
+				logger.Error("failed to explain path",
+					zap.Error(err),
+					zap.String("path", args[0]),
+				)
+				os.Exit(1)
+			}
+		},
+	}
+}
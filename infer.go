@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"cuelang.org/go/cue/format"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// shape is the type inferred from every value seen at one place of the data.
+type shape struct {
+	// kinds holds the scalar kinds seen: string, int, number, bool and null.
+	kinds map[string]bool
+	// structs counts the maps seen, fieldCounts how many of them had each
+	// field. Fields present in every map are required.
+	structs     int
+	fields      map[string]*shape
+	fieldCounts map[string]int
+	// elements is the shape of the list elements, if lists were seen.
+	lists    bool
+	elements *shape
+}
+
+func newShape() *shape {
+	return &shape{kinds: make(map[string]bool), fields: make(map[string]*shape), fieldCounts: make(map[string]int)}
+}
+
+// add widens the shape by value.
+func (s *shape) add(value any) {
+	switch v := value.(type) {
+	case nil:
+		s.kinds["null"] = true
+	case string:
+		s.kinds["string"] = true
+	case bool:
+		s.kinds["bool"] = true
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		s.kinds["int"] = true
+	case float32, float64:
+		s.kinds["number"] = true
+	case Data:
+		s.addMap(v)
+	case map[string]any:
+		s.addMap(v)
+	case []any:
+		s.lists = true
+		if s.elements == nil {
+			s.elements = newShape()
+		}
+		for _, item := range v {
+			s.elements.add(item)
+		}
+	default:
+		// Anything else, e.g. TOML dates, is rendered as a string
+		s.kinds["string"] = true
+	}
+}
+
+func (s *shape) addMap(m map[string]any) {
+	s.structs++
+	for key, item := range m {
+		field, ok := s.fields[key]
+		if !ok {
+			field = newShape()
+			s.fields[key] = field
+		}
+		field.add(item)
+		s.fieldCounts[key]++
+	}
+}
+
+// cueIdentifier matches field names that need no quotes in CUE.
+var cueIdentifier = regexp.MustCompile(`^[a-zA-Z$][a-zA-Z0-9_$]*$`)
+
+// cueKeywords are quoted even though they match cueIdentifier.
+var cueKeywords = map[string]bool{
+	"package": true, "import": true, "for": true, "in": true, "if": true, "let": true,
+	"true": true, "false": true, "null": true, "div": true, "mod": true, "quo": true, "rem": true,
+}
+
+// cueLabel returns name as a CUE field label.
+func cueLabel(name string) string {
+	if cueIdentifier.MatchString(name) && !cueKeywords[name] {
+		return name
+	}
+	return strconv.Quote(name)
+}
+
+// cue renders the shape as a CUE expression.
+func (s *shape) cue() string {
+	var alternatives []string
+	// int is part of number, so only keep the wider kind
+	if s.kinds["int"] && s.kinds["number"] {
+		delete(s.kinds, "int")
+	}
+	for _, kind := range []string{"string", "int", "number", "bool", "null"} {
+		if s.kinds[kind] {
+			alternatives = append(alternatives, kind)
+		}
+	}
+
+	if s.lists {
+		element := "_"
+		if s.elements != nil && (len(s.elements.kinds) > 0 || s.elements.structs > 0 || s.elements.lists) {
+			element = s.elements.cue()
+		}
+		alternatives = append(alternatives, fmt.Sprintf("[...%s]", element))
+	}
+
+	if s.structs > 0 {
+		keys := make([]string, 0, len(s.fields))
+		for key := range s.fields {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		var b strings.Builder
+		b.WriteString("{\n")
+		for _, key := range keys {
+			optional := ""
+			if s.fieldCounts[key] < s.structs {
+				optional = "?"
+			}
+			fmt.Fprintf(&b, "%s%s: %s\n", cueLabel(key), optional, s.fields[key].cue())
+		}
+		b.WriteString("}")
+		alternatives = append(alternatives, b.String())
+	}
+
+	if len(alternatives) == 0 {
+		return "_"
+	}
+	return strings.Join(alternatives, " | ")
+}
+
+// inferSchema returns a formatted CUE file defining a #Schema that every given
+// data tree passes. Fields missing from some trees are optional.
+func inferSchema(datas []Data) ([]byte, error) {
+	root := newShape()
+	for _, data := range datas {
+		root.add(data)
+	}
+	if root.structs == 0 {
+		root.add(Data{})
+	}
+
+	source := "// Inferred by dingo schema infer, review before use.\n\n#Schema: " + root.cue() + "\n"
+	formatted, err := format.Source([]byte(source))
+	if err != nil {
+		return nil, fmt.Errorf("failed to format inferred schema: %w", err)
+	}
+	return formatted, nil
+}
+
+// newSchemaCmd returns the command grouping schema tooling.
+func newSchemaCmd() *cobra.Command {
+	schemaCmd := &cobra.Command{
+		Use:   "schema",
+		Short: "Schema tooling",
+	}
+
+	var outputFile string
+	inferCmd := &cobra.Command{
+		Use:   "infer",
+		Short: "Infers a starting CUE schema from the base and every overlay",
+		Long: `Infers a starting CUE schema from the base and every overlay.
+
+Every directory below --overlaysdir is merged with the base in turn. The
+inferred #Schema accepts all of them: fields missing from some overlays are
+optional, list element types are the union of all elements seen.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			overlays, err := discoverOverlays(overlaysDir)
+			if err != nil {
+				logger.Error("failed to discover overlays",
+					zap.Error(err),
+					zap.String("overlaysDir", overlaysDir),
+				)
+				os.Exit(1)
+			}
+			// Without overlays, infer from the base alone
+			if len(overlays) == 0 {
+				overlays = []string{""}
+			}
+
+			var datas []Data
+			for _, overlay := range overlays {
+				var overlayPaths []string
+				if len(overlay) > 0 {
+					overlayPaths = []string{overlay}
+				}
+				mergedData, err := loadAndMergeYAMLFiles(basePath, overlayPaths...)
+				if err == nil {
+					err = resolveReferences(mergedData)
+				}
+				if err != nil {
+					logger.Error("failed to load YAML files",
+						zap.Error(err),
+						zap.String("basePath", basePath),
+						zap.String("overlay", overlay),
+					)
+					os.Exit(1)
+				}
+				datas = append(datas, mergedData)
+			}
+
+			schema, err := inferSchema(datas)
+			if err != nil {
+				logger.Error("failed to infer schema",
+					zap.Error(err),
+				)
+				os.Exit(1)
+			}
+
+			if len(outputFile) == 0 {
+				cmd.OutOrStdout().Write(schema)
+				return
+			}
+			if err := os.WriteFile(outputFile, schema, 0644); err != nil {
+				logger.Error("failed to write schema",
+					zap.Error(err),
+					zap.String("output", outputFile),
+				)
+				os.Exit(1)
+			}
+		},
+	}
+	inferCmd.Flags().StringVarP(&outputFile, "output", "o", "", "File to write the schema to, defaults to stdout")
+
+	schemaCmd.AddCommand(inferCmd)
+	return schemaCmd
+}
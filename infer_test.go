@@ -0,0 +1,80 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDiscoverOverlays(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "prod", "data.yaml"), "env: prod\n")
+	writeTestFile(t, filepath.Join(dir, "dev", "data.yaml"), "env: dev\n")
+	writeTestFile(t, filepath.Join(dir, ".hidden", "data.yaml"), "env: hidden\n")
+	writeTestFile(t, filepath.Join(dir, "README.md"), "not an overlay\n")
+
+	overlays, err := discoverOverlays(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{filepath.Join(dir, "dev"), filepath.Join(dir, "prod")}
+	if !reflect.DeepEqual(overlays, expected) {
+		t.Errorf("expected overlays %v, got %v", expected, overlays)
+	}
+
+	if _, err := discoverOverlays(filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected an error for a missing overlays directory")
+	}
+}
+
+func TestInferSchema(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "base", "data.yaml"), "name: app\nport: 8080\nservers:\n  - name: a\n    weight: 1\n")
+	writeTestFile(t, filepath.Join(dir, "overlays", "dev", "data.yaml"), "debug: true\nratio: 1\n")
+	writeTestFile(t, filepath.Join(dir, "overlays", "prod", "data.yaml"), "ratio: 0.5\nservers:\n  - name: b\n  - name: c\n    weight: 2\ntags: []\n\"my-key\": null\n")
+
+	overlays, err := discoverOverlays(filepath.Join(dir, "overlays"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var datas []Data
+	for _, overlay := range overlays {
+		data, err := loadAndMergeYAMLFiles(filepath.Join(dir, "base"), overlay)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		datas = append(datas, data)
+	}
+
+	schema, err := inferSchema(datas)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := `// Inferred by dingo schema infer, review before use.
+
+#Schema: {
+	debug?:    bool
+	"my-key"?: null
+	name:      string
+	port:      int
+	ratio:     number
+	servers: [...{
+		name:    string
+		weight?: int
+	}]
+	tags?: [...]
+}
+`
+	if string(schema) != expected {
+		t.Errorf("expected schema:\n%s\ngot:\n%s", expected, schema)
+	}
+
+	// Every overlay passes the inferred schema
+	path := filepath.Join(dir, "schema.cue")
+	writeTestFile(t, path, string(schema))
+	for i, data := range datas {
+		if _, err := newValidator(path).validate(data); err != nil {
+			t.Errorf("expected %s to pass the inferred schema, got: %v", overlays[i], err)
+		}
+	}
+}
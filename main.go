@@ -1,9 +1,14 @@
 package main
 
 import (
+	"context"
 	_ "embed"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	"github.com/alxndr13/dingo/decrypt"
 	"github.com/spf13/cobra"
@@ -11,6 +16,8 @@ import (
 	"go.uber.org/zap"
 )
 
+// schemaFile is the fallback schema for projects without --schema.
+//
 //go:embed schema.cue
 var schemaFile string
 
@@ -18,31 +25,112 @@ type Data map[string]any
 
 var (
 	basePath     string
-	overlayPath  string
+	overlayPaths []string
+	overlaysDir  string
 	templatePath string
 	logMode      string
 	decryptor    string
-	logger       *zap.Logger
+	configFile   string
+	schemaPath   string
+	// secretSchemaPath is the schema validating the data after decryption.
+	secretSchemaPath string
+	// debug adds the merged data to the logs.
+	debug  bool
+	logger = zap.NewNop()
 )
 
-func initDecryptor(decryptor string) (Decryptor, error) {
-	switch decryptor {
-	case "example":
-		return decrypt.NewExampleDecryptor(), nil
+// initDecryptor returns the decryptor registered as name, or the external
+// dingo-decryptor-<name> plugin, see decrypt.New.
+func initDecryptor(name string) (Decryptor, error) {
+	return decrypt.New(name)
+}
+
+// initConfig reads the project config file. Without --config an optional
+// dingo.yaml in the working directory is used.
+func initConfig() error {
+	if len(configFile) > 0 {
+		viper.SetConfigFile(configFile)
+	} else {
+		viper.SetConfigName("dingo")
+		viper.SetConfigType("yaml")
+		viper.AddConfigPath(".")
+	}
+
+	if err := viper.ReadInConfig(); err != nil {
+		var notFound viper.ConfigFileNotFoundError
+		if len(configFile) > 0 || !errors.As(err, &notFound) {
+			return fmt.Errorf("failed to read config file: %w", err)
+		}
+	}
+
+	schemaPath = viper.GetString("schema")
+	secretSchemaPath = viper.GetString("secretschema")
+	decryptor = viper.GetString("decryptor")
+	debug = viper.GetBool("debug")
+
+	schemes := viper.GetStringMapString("secrets.schemes")
+	for scheme, name := range schemes {
+		if !secretSchemePattern.MatchString(scheme) {
+			return fmt.Errorf("invalid secret scheme %q for decryptor %s, schemes are lowercase letters, digits and dashes", scheme, name)
+		}
+	}
+	secretSchemes = schemes
 
-	case "google":
-		return decrypt.NewGoogleDecryptor(), nil
+	if viper.IsSet("secrets.workers") {
+		workers := viper.GetInt("secrets.workers")
+		if workers < 1 {
+			return fmt.Errorf("invalid secrets.workers %d, at least one worker is needed", workers)
+		}
+		secretWorkers = workers
+	}
+
+	policy := decrypt.DefaultCallPolicy
+	if viper.IsSet("secrets.timeout") {
+		policy.Timeout = viper.GetDuration("secrets.timeout")
+	}
+	if viper.IsSet("secrets.retries") {
+		policy.Retries = viper.GetInt("secrets.retries")
+	}
+	if viper.IsSet("secrets.backoff") {
+		policy.Backoff = viper.GetDuration("secrets.backoff")
+	}
+	if viper.IsSet("secrets.max_backoff") {
+		policy.MaxBackoff = viper.GetDuration("secrets.max_backoff")
+	}
+	if policy.Timeout < 0 || policy.Retries < 0 || policy.Backoff < 0 || policy.MaxBackoff < 0 {
+		return fmt.Errorf("invalid secrets.timeout, secrets.retries, secrets.backoff or secrets.max_backoff, they must not be negative")
+	}
+	secretCallPolicy = policy
 
+	var rules []listMergeRule
+	if err := viper.UnmarshalKey("merge.lists", &rules); err != nil {
+		return fmt.Errorf("failed to read list merge rules: %w", err)
 	}
-	return nil, fmt.Errorf("no such decryptor")
+	for i := range rules {
+		if err := rules[i].validate(); err != nil {
+			return err
+		}
+	}
+	listMergeRules = rules
 
+	var policies []policyRule
+	if err := viper.UnmarshalKey("policy.rules", &policies); err != nil {
+		return fmt.Errorf("failed to read policy rules: %w", err)
+	}
+	for i := range policies {
+		if err := policies[i].validate(); err != nil {
+			return err
+		}
+	}
+	policyRules = policies
+	return nil
 }
 
 func initLogger() error {
 	var err error
 
 	if len(logMode) == 0 {
-		logger, err = zap.NewDevelopment()
+		logger, err = newLogger(zap.NewDevelopmentConfig())
 		if err != nil {
 			return err
 		}
@@ -51,17 +139,17 @@ func initLogger() error {
 
 	switch logMode {
 	case "human":
-		logger, err = zap.NewDevelopment()
+		logger, err = newLogger(zap.NewDevelopmentConfig())
 		if err != nil {
 			return err
 		}
 	case "json":
-		logger, err = zap.NewProduction()
+		logger, err = newLogger(zap.NewProductionConfig())
 		if err != nil {
 			return err
 		}
 	default:
-		logger, err = zap.NewProduction()
+		logger, err = newLogger(zap.NewProductionConfig())
 		if err != nil {
 			return err
 		}
@@ -70,73 +158,187 @@ func initLogger() error {
 	return nil
 }
 
+// newLogger builds a logger from cfg that masks decrypted secrets in every
+// log line, see redactingSink.
+func newLogger(cfg zap.Config) (*zap.Logger, error) {
+	cfg.OutputPaths = []string{redactedSinkScheme + ":stderr"}
+	cfg.ErrorOutputPaths = []string{redactedSinkScheme + ":stderr"}
+	return cfg.Build()
+}
+
+// dataField returns data as log field with --debug, and a field that is left
+// out otherwise. Data dumps are noisy and may hold secrets the redaction does
+// not know about, such as values derived from them.
+func dataField(data Data) zap.Field {
+	if !debug {
+		return zap.Skip()
+	}
+	return zap.Any("data", data)
+}
+
+// exitValidationFailed reports a failed validation and exits. Issues are
+// written as a validation report, located by prov.
+func exitValidationFailed(err error, prov provenance, message string) {
+	var validationErr *validationError
+	if !errors.As(err, &validationErr) {
+		logger.Error(message,
+			zap.Error(err),
+		)
+		os.Exit(1)
+	}
+
+	prov.locate(validationErr.Issues)
+	if err := writeValidationReport(os.Stdout, validationErr.Issues); err != nil {
+		logger.Error("failed to write validation report",
+			zap.Error(err),
+		)
+	}
+	logger.Error(message,
+		zap.Int("issues", len(validationErr.Issues)),
+	)
+	os.Exit(1)
+}
+
 func main() {
 	var rootCmd = &cobra.Command{
 		Use:   "dingo",
 		Short: "Merges and validates data to template $stuff",
-		Run: func(cmd *cobra.Command, args []string) {
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
 			err := initLogger()
 			if err != nil {
 				zap.Error(err)
 				os.Exit(1)
 			}
 
-			mergedData, err := loadAndMergeYAMLFiles(basePath, overlayPath)
+			if err := initConfig(); err != nil {
+				logger.Error("failed to load config",
+					zap.Error(err),
+					zap.String("config", configFile),
+				)
+				os.Exit(1)
+			}
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			mergedData, prov, err := loadAndTrackYAMLFiles(basePath, overlayPaths...)
 			if err != nil {
 				logger.Error("failed to load YAML files",
 					zap.Error(err),
 					zap.String("basePath", basePath),
-					zap.String("overlayPath", overlayPath),
+					zap.Strings("overlayPaths", overlayPaths),
 				)
 				os.Exit(1)
 			}
 
-			if err := validateData(mergedData); err != nil {
-				logger.Error("validation failed",
+			if err := resolveReferences(mergedData); err != nil {
+				logger.Error("failed to resolve references",
 					zap.Error(err),
-					zap.Any("data", mergedData),
 				)
 				os.Exit(1)
 			}
 
-			if len(decryptor) > 0 {
-				// Decrypt secrets in mergedData
-				decryptor, err := initDecryptor(decryptor)
-				if err != nil {
-					zap.Error(err)
+			// Continue with the validated data, it includes the schema defaults
+			validatedData, warnings, err := checkData(mergedData, overlayPaths)
+			if err != nil {
+				exitValidationFailed(err, prov, "validation failed")
+			}
+			mergedData = validatedData
+
+			if len(warnings) > 0 {
+				prov.locate(warnings)
+				if err := writeValidationReport(os.Stdout, warnings); err != nil {
+					logger.Error("failed to write validation report",
+						zap.Error(err),
+					)
 				}
-				if err := decryptSecrets(&mergedData, decryptor); err != nil {
-					logger.Error("secret decryption failed",
+				logger.Warn("policy rules found warnings",
+					zap.Int("warnings", len(warnings)),
+				)
+			}
+
+			// Fail early on an unknown default decryptor, it is only
+			// initialised once a reference needs it
+			if len(decryptor) > 0 {
+				if _, err := initDecryptor(decryptor); err != nil {
+					logger.Error("failed to initialise decryptor",
 						zap.Error(err),
-						zap.Any("data", mergedData),
 					)
 					os.Exit(1)
 				}
+			}
+
+			// Keep the encrypted data to tell which values are secrets
+			encryptedData := copyValue(mergedData).(Data)
+
+			// Decrypt secrets in mergedData, routed by their scheme. Ctrl-C
+			// cancels the calls in flight
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			router := newSecretRouter(decryptor, secretSchemes)
+			err = decryptSecretsContext(ctx, &mergedData, router)
+			// The decryptors are done, close them before any exit below as
+			// plugins run until they are closed
+			stop()
+			if err := router.Close(); err != nil {
+				logger.Warn("failed to close decryptors",
+					zap.Error(err),
+				)
+			}
+			if err != nil {
+				logger.Error("secret decryption failed",
+					zap.Error(err),
+					dataField(mergedData),
+				)
+				os.Exit(1)
+			}
 
+			if len(secretSchemaPath) > 0 {
+				if router.decrypted.Load() {
+					validatedData, err := validateDecryptedData(encryptedData, mergedData)
+					if err != nil {
+						exitValidationFailed(err, prov, "post-decryption validation failed")
+					}
+					mergedData = validatedData
+				} else {
+					logger.Warn("skipping post-decryption validation, no secrets were decrypted",
+						zap.String("secretSchema", secretSchemaPath),
+					)
+				}
 			}
 
 			logger.Info("data loaded and validated successfully",
-				zap.Any("data", mergedData),
+				dataField(mergedData),
 			)
 
 			if err := templateFiles("./templates", "./output", mergedData); err != nil {
 				logger.Error("templating failed",
 					zap.Error(err),
-					zap.Any("data", mergedData),
+					dataField(mergedData),
 				)
 				os.Exit(1)
 			}
 		},
 	}
 
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", "", "Project config file, defaults to dingo.yaml in the working directory if present")
 	rootCmd.PersistentFlags().StringVar(&basePath, "basepath", "data/base", "Base directory for YAML files")
-	rootCmd.PersistentFlags().StringVar(&overlayPath, "overlaypath", "data/overlays/dev", "Overlay directory for YAML files")
+	rootCmd.PersistentFlags().StringSliceVar(&overlayPaths, "overlaypath", []string{"data/overlays/dev"}, "Overlay directories for YAML files, applied in the given order (repeat the flag or separate with commas)")
+	rootCmd.PersistentFlags().StringVar(&overlaysDir, "overlaysdir", "data/overlays", "Directory holding one directory per overlay, used by commands working on every overlay")
+	rootCmd.PersistentFlags().StringVar(&schemaPath, "schema", "", "CUE schema file or package directory defining #Schema, or a .json JSON Schema, defaults to the embedded demo schema")
+	rootCmd.PersistentFlags().StringVar(&secretSchemaPath, "secretschema", "", "Schema validating the data after decryption, in the same formats as --schema, empty to skip")
 	rootCmd.PersistentFlags().StringVar(&templatePath, "templatepath", "templates", "Template files to template")
 	rootCmd.PersistentFlags().StringVar(&logMode, "logmode", "human", "Log Mode, available values [human, json]")
-	rootCmd.PersistentFlags().StringVar(&decryptor, "decryptor", "", "Decryptor in case you're using secrets, leave empty if you do not want to use one. available values [example, google]")
+	rootCmd.PersistentFlags().BoolVar(&debug, "debug", false, "Include the merged data in the logs, decrypted secrets are still masked")
+	rootCmd.PersistentFlags().StringVar(&decryptor, "decryptor", "", fmt.Sprintf("Default decryptor for secret references without a scheme, leave empty to keep them as they are. available values [%s], or the name of a %s<name> executable in PATH", strings.Join(decrypt.Names(), ", "), decrypt.PluginPrefix))
+
+	// Errors cobra prints itself bypass the logger
+	rootCmd.SetErr(trackedSecrets.writer(os.Stderr))
+
+	rootCmd.AddCommand(newExplainCmd())
+	rootCmd.AddCommand(newSchemaCmd())
+	rootCmd.AddCommand(newSecretCmd())
+	rootCmd.AddCommand(newValidateCmd())
 
 	// bindFlags binds command line flags to viper configuration
-	flags := []string{"basepath", "overlaypath", "templatepath", "logmode"}
+	flags := []string{"basepath", "overlaypath", "overlaysdir", "templatepath", "logmode", "schema", "secretschema", "decryptor", "debug"}
 	for _, flag := range flags {
 		if err := viper.BindPFlag(flag, rootCmd.PersistentFlags().Lookup(flag)); err != nil {
 			logger.Fatal("failed to bind flag",
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// policySeverity is the severity of a policy finding. Errors fail validation,
+// warnings are only reported.
+type policySeverity string
+
+const (
+	policyError   policySeverity = "error"
+	policyWarning policySeverity = "warning"
+)
+
+// secretReferencePattern matches a value consisting of a single secret
+// reference.
+var secretReferencePattern = regexp.MustCompile(`^` + REGEX_STRING + `$`)
+
+// policyRule is an organisational rule checked against the merged data. It
+// applies to the values at Path and below keys matching Key, and checks every
+// scalar value at or below them.
+type policyRule struct {
+	Name string `mapstructure:"name"`
+	// Message describes a finding, defaults to a description of the check.
+	Message  string         `mapstructure:"message"`
+	Severity policySeverity `mapstructure:"severity"`
+	// Path is a dotted key path, "*" matches any single segment.
+	Path string `mapstructure:"path"`
+	// Key is a glob matched against key names regardless of case, e.g.
+	// "*password*".
+	Key string `mapstructure:"key"`
+	// Overlay restricts the rule to runs with an overlay layer whose
+	// directory name matches this glob, e.g. "prod*".
+	Overlay string `mapstructure:"overlay"`
+
+	// Secret requires values to be a $$secretname$$ reference.
+	Secret bool `mapstructure:"secret"`
+	// Deny lists values that are not allowed.
+	Deny []any `mapstructure:"deny"`
+	// Pattern is a regular expression values have to match.
+	Pattern string `mapstructure:"pattern"`
+
+	pattern *regexp.Regexp
+}
+
+// policyRules are the project wide policy rules, see initConfig.
+var policyRules []policyRule
+
+// validate checks the rule and fills in the default severity.
+func (r *policyRule) validate() error {
+	if len(r.Name) == 0 {
+		return fmt.Errorf("policy rule without a name")
+	}
+	switch r.Severity {
+	case "":
+		r.Severity = policyError
+	case policyError, policyWarning:
+	default:
+		return fmt.Errorf("unknown severity %q for policy rule %s, available values [error, warning]", r.Severity, r.Name)
+	}
+	if len(r.Path) == 0 && len(r.Key) == 0 {
+		return fmt.Errorf("policy rule %s needs a path or a key", r.Name)
+	}
+	for _, glob := range []string{r.Key, r.Overlay} {
+		if _, err := filepath.Match(glob, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q for policy rule %s: %v", glob, r.Name, err)
+		}
+	}
+	if !r.Secret && len(r.Deny) == 0 && len(r.Pattern) == 0 {
+		return fmt.Errorf("policy rule %s checks nothing, set secret, deny or pattern", r.Name)
+	}
+	if len(r.Pattern) > 0 {
+		pattern, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern for policy rule %s: %v", r.Name, err)
+		}
+		r.pattern = pattern
+	}
+	return nil
+}
+
+// appliesTo reports whether the rule applies to runs with the given overlay
+// layers.
+func (r policyRule) appliesTo(layers []string) bool {
+	if len(r.Overlay) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(layers, func(layer string) bool {
+		matched, _ := filepath.Match(r.Overlay, filepath.Base(layer))
+		return matched
+	})
+}
+
+// selects reports whether the rule checks the value at path.
+func (r policyRule) selects(path []string) bool {
+	if len(path) == 0 {
+		return false
+	}
+	if len(r.Path) > 0 {
+		segments := strings.Split(r.Path, ".")
+		if len(segments) != len(path) {
+			return false
+		}
+		for i, segment := range segments {
+			if segment != "*" && segment != path[i] {
+				return false
+			}
+		}
+	}
+	if len(r.Key) > 0 {
+		matched, _ := filepath.Match(strings.ToLower(r.Key), strings.ToLower(path[len(path)-1]))
+		return matched
+	}
+	return true
+}
+
+// check returns a finding for value, a scalar at path, if it breaks the rule.
+func (r policyRule) check(value any, path []string) (validationIssue, bool) {
+	issue := validationIssue{
+		Path:     joinPath(path),
+		Rule:     r.Name,
+		Severity: string(r.Severity),
+	}
+
+	s, isString := value.(string)
+	switch {
+	case r.Secret && (!isString || !secretReferencePattern.MatchString(s)):
+		// The value is probably a plain secret, so it is not reported
+		issue.Message = "must be a $$secretname$$ reference"
+	case slices.ContainsFunc(r.Deny, func(denied any) bool { return formatValue(denied) == formatValue(value) }):
+		issue.Message = fmt.Sprintf("value %s is not allowed", formatValue(value))
+		issue.Value = value
+	case r.pattern != nil && (!isString || !r.pattern.MatchString(s)):
+		issue.Message = fmt.Sprintf("must match %q", r.Pattern)
+		issue.Value = value
+	default:
+		return issue, false
+	}
+
+	if len(r.Message) > 0 {
+		issue.Message = r.Message
+	}
+	return issue, true
+}
+
+// checkPolicies returns the findings of every policy rule that applies to
+// the given overlay layers.
+func checkPolicies(data Data, rules []policyRule, layers []string) []validationIssue {
+	var issues []validationIssue
+	for _, rule := range rules {
+		if !rule.appliesTo(layers) {
+			continue
+		}
+		rule.walk(data, nil, false, &issues)
+	}
+	return issues
+}
+
+// walk checks the scalars at and below value, which lives at path. selected
+// is set once a parent of value is selected by the rule.
+func (r policyRule) walk(value any, path []string, selected bool, issues *[]validationIssue) {
+	selected = selected || r.selects(path)
+
+	if list, ok := value.([]any); ok {
+		for i, item := range list {
+			r.walk(item, append(slices.Clip(path), strconv.Itoa(i)), selected, issues)
+		}
+		return
+	}
+
+	m, ok := asMap(value)
+	if !ok {
+		if !selected {
+			return
+		}
+		if issue, found := r.check(value, path); found {
+			*issues = append(*issues, issue)
+		}
+		return
+	}
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		r.walk(m[key], append(slices.Clip(path), key), selected, issues)
+	}
+}
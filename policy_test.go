@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPolicyRuleValidate(t *testing.T) {
+	rule := policyRule{Name: "secrets", Key: "*password*", Secret: true}
+	if err := rule.validate(); err != nil {
+		t.Fatalf("validate returned error: %v", err)
+	}
+	if rule.Severity != policyError {
+		t.Errorf("expected default severity %q, got %q", policyError, rule.Severity)
+	}
+
+	invalid := map[string]policyRule{
+		"no name":          {Key: "*password*", Secret: true},
+		"unknown severity": {Name: "r", Key: "*password*", Secret: true, Severity: "fatal"},
+		"no selector":      {Name: "r", Secret: true},
+		"no check":         {Name: "r", Path: "debug"},
+		"bad key glob":     {Name: "r", Key: "[", Secret: true},
+		"bad pattern":      {Name: "r", Path: "name", Pattern: "("},
+	}
+	for name, rule := range invalid {
+		if err := rule.validate(); err == nil {
+			t.Errorf("%s: expected an error, but got nil", name)
+		}
+	}
+}
+
+func TestCheckPolicies(t *testing.T) {
+	rules := []policyRule{
+		{Name: "passwords-are-secrets", Key: "*password*", Secret: true},
+		{Name: "no-debug-in-prod", Overlay: "prod*", Path: "debug", Deny: []any{true}, Message: "debug must be off in prod"},
+		{Name: "hostnames", Path: "hosts.*", Pattern: `^[a-z.]+$`, Severity: policyWarning},
+	}
+	for i := range rules {
+		if err := rules[i].validate(); err != nil {
+			t.Fatalf("validate returned error: %v", err)
+		}
+	}
+
+	data := Data{
+		"debug":       true,
+		"DB_PASSWORD": "plain",
+		"passwords":   []any{"$$first$$", "second"},
+		"network":     map[string]any{"vpn_password": "$$vpn$$", "port": uint64(1194)},
+		"hosts":       []any{"db.local", "API"},
+	}
+
+	issues := checkPolicies(data, rules, []string{"data/overlays/eu", "data/overlays/prod-a"})
+	expected := []validationIssue{
+		{Path: "DB_PASSWORD", Message: "must be a $$secretname$$ reference", Rule: "passwords-are-secrets", Severity: "error"},
+		{Path: "passwords.1", Message: "must be a $$secretname$$ reference", Rule: "passwords-are-secrets", Severity: "error"},
+		{Path: "debug", Message: "debug must be off in prod", Value: true, Rule: "no-debug-in-prod", Severity: "error"},
+		{Path: "hosts.1", Message: `must match "^[a-z.]+$"`, Value: "API", Rule: "hostnames", Severity: "warning"},
+	}
+	if !reflect.DeepEqual(issues, expected) {
+		t.Errorf("expected issues %+v, got %+v", expected, issues)
+	}
+
+	// Overlay rules only apply to matching overlays
+	issues = checkPolicies(data, rules[1:2], []string{"data/overlays/dev"})
+	if len(issues) != 0 {
+		t.Errorf("expected no issues for the dev overlay, got %+v", issues)
+	}
+}
+
+func TestCheckData(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "prod", "data.yaml"), "debug: true\n")
+	writeTestFile(t, filepath.Join(dir, "schema.cue"), "#Schema: {\n\tname: string\n\tdebug: bool\n}\n")
+
+	defer func(previous string) { schemaPath = previous }(schemaPath)
+	schemaPath = filepath.Join(dir, "schema.cue")
+
+	defer func(previous []policyRule) { policyRules = previous }(policyRules)
+	policyRules = []policyRule{
+		{Name: "debug-warning", Path: "debug", Deny: []any{true}, Severity: policyWarning},
+		{Name: "no-debug-in-prod", Overlay: "prod", Path: "debug", Deny: []any{true}},
+	}
+	for i := range policyRules {
+		if err := policyRules[i].validate(); err != nil {
+			t.Fatalf("validate returned error: %v", err)
+		}
+	}
+
+	data := Data{"name": "app", "debug": true}
+
+	// Warnings alone pass
+	_, warnings, err := checkData(data, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(warnings) != 1 || warnings[0].Rule != "debug-warning" {
+		t.Errorf("expected the debug warning, got %+v", warnings)
+	}
+
+	// Errors fail, the warnings are reported with them
+	_, _, err = checkData(data, []string{filepath.Join(dir, "prod")})
+	var validationErr *validationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	if len(validationErr.Issues) != 2 || countErrors(validationErr.Issues) != 1 {
+		t.Errorf("expected one error and one warning, got %+v", validationErr.Issues)
+	}
+}
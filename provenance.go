@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-yaml/ast"
+)
+
+// origin is one value set for a key path by a data file.
+type origin struct {
+	File string
+	// Line is the line the key is set on, 0 if the format has no positions.
+	Line int
+	// Layer is the base or overlay directory the file belongs to.
+	Layer string
+	Value any
+	// Deleted is set if the file removed the key with !delete.
+	Deleted bool
+	// Secret is set if the file was encrypted, see decryptSOPS. Its values
+	// are never shown.
+	Secret bool
+}
+
+// provenance records every value set for the leaves of the merged data, keyed
+// by dotted key path, in merge order. The last origin of a path is the one
+// that won. Lists are leaves.
+type provenance map[string][]origin
+
+// dataDocument is one decoded document of a data file.
+type dataDocument struct {
+	data Data
+	// lines maps dotted key paths to the line they are set on, if the format
+	// knows positions.
+	lines map[string]int
+	// secret is set for documents of encrypted files.
+	secret bool
+}
+
+// joinPath joins key path segments the way provenance keys them.
+func joinPath(path []string) string {
+	return strings.Join(path, ".")
+}
+
+// record adds the leaves of a document that is about to be merged into base.
+// Lists record the value they merge to, which differs from the document's
+// list if a merge tag or rule combines it with the list in base.
+func (p provenance) record(doc dataDocument, base Data, file, layer string) {
+	p.recordValue(doc.data, base, nil, doc, file, layer)
+}
+
+// recordValue records value set at path, base is the value it is merged into.
+func (p provenance) recordValue(value, base any, path []string, doc dataDocument, file, layer string) {
+	key := joinPath(path)
+	overlay := value
+	switch v := value.(type) {
+	case deleteMarker:
+		o := origin{File: file, Line: doc.lines[key], Layer: layer, Deleted: true}
+		for recorded := range p {
+			if recorded == key || strings.HasPrefix(recorded, key+".") {
+				p[recorded] = append(p[recorded], o)
+			}
+		}
+		return
+	case map[string]any:
+		p.recordMap(v, base, path, doc, file, layer)
+		return
+	case Data:
+		p.recordMap(v, base, path, doc, file, layer)
+		return
+	case taggedList:
+		value = v.items
+	}
+	// A list combined with the list in base records the combined list
+	if baseList, ok := base.([]any); ok {
+		if rule, items, ok := overlayListRule(copyValue(overlay), path); ok {
+			value = mergeLists(copyValue(baseList).([]any), items, rule, path)
+		}
+	}
+	// A value that is not a map replaces every key below it
+	p.pruneBelow(key)
+	p[key] = append(p[key], origin{
+		File:   file,
+		Line:   doc.lines[key],
+		Layer:  layer,
+		Value:  stripMergeTags(copyValue(value)),
+		Secret: doc.secret,
+	})
+}
+
+func (p provenance) recordMap(m map[string]any, base any, path []string, doc dataDocument, file, layer string) {
+	baseMap, baseIsMap := asMap(base)
+	// An empty map is a leaf of its own, unless it is merged into a map and
+	// changes nothing
+	if len(m) == 0 && len(path) > 0 && !baseIsMap {
+		key := joinPath(path)
+		p[key] = append(p[key], origin{File: file, Line: doc.lines[key], Layer: layer, Value: map[string]any{}})
+		return
+	}
+	// A map replaces a value that was not a map
+	if len(m) > 0 && len(path) > 0 {
+		delete(p, joinPath(path))
+	}
+	for key, item := range m {
+		p.recordValue(item, baseMap[key], append(slices.Clip(path), key), doc, file, layer)
+	}
+}
+
+// pruneBelow removes the origins of the paths below key, whose values have been
+// replaced as a whole.
+func (p provenance) pruneBelow(key string) {
+	if len(key) == 0 {
+		return
+	}
+	for recorded := range p {
+		if strings.HasPrefix(recorded, key+".") {
+			delete(p, recorded)
+		}
+	}
+}
+
+// lookup returns the origins of path. Paths below a leaf, such as list
+// elements, fall back to the closest recorded parent.
+func (p provenance) lookup(path string) ([]origin, bool) {
+	for {
+		if origins, ok := p[path]; ok {
+			return origins, true
+		}
+		i := strings.LastIndex(path, ".")
+		if i < 0 {
+			return nil, false
+		}
+		path = path[:i]
+	}
+}
+
+// below returns the recorded paths equal to or below path, sorted.
+func (p provenance) below(path string) []string {
+	var paths []string
+	for recorded := range p {
+		if len(path) == 0 || recorded == path || strings.HasPrefix(recorded, path+".") {
+			paths = append(paths, recorded)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// location formats where the origin was set, as file:line if the line is
+// known.
+func (o origin) location() string {
+	if o.Line > 0 {
+		return fmt.Sprintf("%s:%d", o.File, o.Line)
+	}
+	return o.File
+}
+
+// formatValue formats the value of the origin, or redactedValue for secrets.
+func (o origin) formatValue() string {
+	if o.Secret {
+		return redactedValue
+	}
+	return formatValue(o.Value)
+}
+
+// explain writes the winning value of every leaf at or below path together
+// with the values it overrode. Tracked secrets are masked.
+func (p provenance) explain(w io.Writer, path string) error {
+	w = trackedSecrets.writer(w)
+	paths := p.below(path)
+	if len(paths) == 0 {
+		return fmt.Errorf("no data file sets %q", path)
+	}
+
+	for _, leaf := range paths {
+		origins := p[leaf]
+		winner := origins[len(origins)-1]
+		if winner.Deleted {
+			fmt.Fprintf(w, "%s deleted by %s (layer %s)\n", leaf, winner.location(), winner.Layer)
+		} else {
+			fmt.Fprintf(w, "%s = %s\n", leaf, winner.formatValue())
+			fmt.Fprintf(w, "  set by %s (layer %s)\n", winner.location(), winner.Layer)
+		}
+		if len(origins) > 1 {
+			fmt.Fprintln(w, "  overrides:")
+			for i := len(origins) - 2; i >= 0; i-- {
+				o := origins[i]
+				if o.Deleted {
+					fmt.Fprintf(w, "    deleted by %s (layer %s)\n", o.location(), o.Layer)
+					continue
+				}
+				fmt.Fprintf(w, "    %s from %s (layer %s)\n", o.formatValue(), o.location(), o.Layer)
+			}
+		}
+	}
+	return nil
+}
+
+// formatValue formats a data value as JSON for explain output.
+func formatValue(value any) string {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(content)
+}
+
+// copyValue deep copies maps and lists, so later merges can not change
+// recorded values.
+func copyValue(value any) any {
+	switch v := value.(type) {
+	case Data:
+		return Data(copyMap(v))
+	case map[string]any:
+		return copyMap(v)
+	case []any:
+		list := make([]any, len(v))
+		for i, item := range v {
+			list[i] = copyValue(item)
+		}
+		return list
+	case taggedList:
+		return taggedList{rule: v.rule, items: copyValue(v.items).([]any)}
+	}
+	return value
+}
+
+func copyMap(m map[string]any) map[string]any {
+	copied := make(map[string]any, len(m))
+	for key, item := range m {
+		copied[key] = copyValue(item)
+	}
+	return copied
+}
+
+// yamlLines records the line of every key and list element below node.
+func yamlLines(node ast.Node, path []string, lines map[string]int) {
+	switch n := node.(type) {
+	case *ast.TagNode:
+		yamlLines(n.Value, path, lines)
+	case *ast.AnchorNode:
+		yamlLines(n.Value, path, lines)
+	case *ast.MappingNode:
+		for _, pair := range n.Values {
+			yamlLines(pair, path, lines)
+		}
+	case *ast.MappingValueNode:
+		token := n.Key.GetToken()
+		keyPath := append(slices.Clip(path), token.Value)
+		lines[joinPath(keyPath)] = token.Position.Line
+		yamlLines(n.Value, keyPath, lines)
+	case *ast.SequenceNode:
+		for i, item := range n.Values {
+			itemPath := append(slices.Clip(path), strconv.Itoa(i))
+			if token := item.GetToken(); token != nil {
+				lines[joinPath(itemPath)] = token.Position.Line
+			}
+			yamlLines(item, itemPath, lines)
+		}
+	}
+}
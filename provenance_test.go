@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadAndTrackYAMLFiles_Provenance(t *testing.T) {
+	dir := t.TempDir()
+	baseDir := filepath.Join(dir, "base")
+	overlayDir := filepath.Join(dir, "overlay")
+	writeTestFile(t, filepath.Join(baseDir, "data.yaml"), "name: Charlie Cartwright\nnetwork:\n  cidr: 10.0.0.0/8\n  proxy: proxy.local\n")
+	writeTestFile(t, filepath.Join(overlayDir, "data.yaml"), "network:\n  proxy: !delete\n  cidr: 10.1.0.0/16\nusernames: [Viva26]\n")
+	writeTestFile(t, filepath.Join(overlayDir, "outputs.json"), `{"region": "eu"}`)
+
+	_, prov, err := loadAndTrackYAMLFiles(baseDir, overlayDir)
+	if err != nil {
+		t.Fatalf("loadAndTrackYAMLFiles returned error: %v", err)
+	}
+
+	expected := []origin{
+		{File: filepath.Join(baseDir, "data.yaml"), Line: 3, Layer: baseDir, Value: "10.0.0.0/8"},
+		{File: filepath.Join(overlayDir, "data.yaml"), Line: 3, Layer: overlayDir, Value: "10.1.0.0/16"},
+	}
+	if !reflect.DeepEqual(prov["network.cidr"], expected) {
+		t.Errorf("expected origins %v, got %v", expected, prov["network.cidr"])
+	}
+
+	proxy := prov["network.proxy"]
+	if len(proxy) != 2 || !proxy[1].Deleted || proxy[1].Line != 2 {
+		t.Errorf("expected network.proxy to be deleted on line 2, got %v", proxy)
+	}
+
+	region := prov["region"]
+	if len(region) != 1 || region[0].Line != 0 || region[0].Value != "eu" {
+		t.Errorf("expected region from JSON without a line, got %v", region)
+	}
+
+	if origins, ok := prov.lookup("usernames.0"); !ok || origins[0].Line != 4 {
+		t.Errorf("expected usernames.0 to fall back to usernames, got %v", origins)
+	}
+}
+
+func TestLoadAndTrackYAMLFiles_ProvenanceReplacedMap(t *testing.T) {
+	dir := t.TempDir()
+	baseDir := filepath.Join(dir, "base")
+	overlayDir := filepath.Join(dir, "overlay")
+	writeTestFile(t, filepath.Join(baseDir, "data.yaml"), "proxy:\n  host: proxy.local\n  port: 3128\ndns: 10.0.0.2\n")
+	writeTestFile(t, filepath.Join(overlayDir, "data.yaml"), "proxy: none\ndns:\n  primary: 10.1.0.2\n")
+
+	_, prov, err := loadAndTrackYAMLFiles(baseDir, overlayDir)
+	if err != nil {
+		t.Fatalf("loadAndTrackYAMLFiles returned error: %v", err)
+	}
+
+	expected := []string{"dns.primary", "proxy"}
+	if paths := prov.below(""); !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expected paths %v, got %v", expected, paths)
+	}
+	if err := prov.explain(&bytes.Buffer{}, "proxy.host"); err == nil {
+		t.Error("expected an error for a key replaced by a scalar, but got nil")
+	}
+}
+
+func TestLoadAndTrackYAMLFiles_ProvenanceMergedLists(t *testing.T) {
+	listMergeRules = []listMergeRule{{Path: "hosts", Strategy: listPrepend}}
+	defer func() { listMergeRules = nil }()
+
+	dir := t.TempDir()
+	baseDir := filepath.Join(dir, "base")
+	overlayDir := filepath.Join(dir, "overlay")
+	writeTestFile(t, filepath.Join(baseDir, "data.yaml"), "l: [1, 2]\nhosts: [a]\nservices:\n  - name: api\n    port: 80\n")
+	writeTestFile(t, filepath.Join(overlayDir, "data.yaml"), "l: !append [3]\nhosts: [b]\nservices: !merge:name\n  - name: api\n    port: 9090\n")
+
+	merged, prov, err := loadAndTrackYAMLFiles(baseDir, overlayDir)
+	if err != nil {
+		t.Fatalf("loadAndTrackYAMLFiles returned error: %v", err)
+	}
+
+	// The winning origin holds the merged list
+	for _, path := range []string{"l", "hosts", "services"} {
+		origins := prov[path]
+		if len(origins) != 2 {
+			t.Errorf("%s: expected 2 origins, got %v", path, origins)
+			continue
+		}
+		winner := origins[1].Value
+		if formatValue(winner) != formatValue(merged[path]) {
+			t.Errorf("%s: expected the merged list %s, got %s", path, formatValue(merged[path]), formatValue(winner))
+		}
+	}
+}
+
+func TestLoadAndTrackYAMLFiles_ProvenanceEmptyMap(t *testing.T) {
+	dir := t.TempDir()
+	baseDir := filepath.Join(dir, "base")
+	overlayDir := filepath.Join(dir, "overlay")
+	writeTestFile(t, filepath.Join(baseDir, "data.yaml"), "m:\n  x: 1\nscalar: value\n")
+	writeTestFile(t, filepath.Join(overlayDir, "data.yaml"), "m: {}\nscalar: {}\n")
+
+	_, prov, err := loadAndTrackYAMLFiles(baseDir, overlayDir)
+	if err != nil {
+		t.Fatalf("loadAndTrackYAMLFiles returned error: %v", err)
+	}
+
+	// An empty map merged into a map changes nothing, one replacing a
+	// scalar is the new value
+	expected := []string{"m.x", "scalar"}
+	if paths := prov.below(""); !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expected paths %v, got %v", expected, paths)
+	}
+	if origins := prov["scalar"]; len(origins) != 2 || formatValue(origins[1].Value) != "{}" {
+		t.Errorf("expected scalar to be replaced by an empty map, got %v", origins)
+	}
+}
+
+func TestProvenanceExplain(t *testing.T) {
+	prov := provenance{
+		"network.cidr": {
+			{File: "data/base/data.yaml", Line: 3, Layer: "data/base", Value: "10.0.0.0/8"},
+			{File: "data/overlays/prod/data.yaml", Line: 2, Layer: "data/overlays/prod", Value: "10.1.0.0/16"},
+		},
+		"name": {
+			{File: "data/base/data.yaml", Line: 1, Layer: "data/base", Value: "Charlie Cartwright"},
+		},
+	}
+
+	var out bytes.Buffer
+	if err := prov.explain(&out, "network"); err != nil {
+		t.Fatalf("explain returned error: %v", err)
+	}
+
+	expected := `network.cidr = "10.1.0.0/16"
+  set by data/overlays/prod/data.yaml:2 (layer data/overlays/prod)
+  overrides:
+    "10.0.0.0/8" from data/base/data.yaml:3 (layer data/base)
+`
+	if out.String() != expected {
+		t.Errorf("expected output %q, got %q", expected, out.String())
+	}
+
+	if err := prov.explain(&out, "missing"); err == nil {
+		t.Error("expected an error for an unknown path, but got nil")
+	}
+}
+
+func TestProvenanceLocate(t *testing.T) {
+	prov := provenance{
+		"age":       {{File: "data/base/data.yaml", Line: 2, Layer: "data/base", Value: 177}},
+		"passwords": {{File: "data/overlays/dev/data.yaml", Line: 3, Layer: "data/overlays/dev", Value: []any{1}}},
+	}
+
+	issues := []validationIssue{{Path: "age"}, {Path: "passwords.0"}, {Path: "network.cidr"}}
+	prov.locate(issues)
+
+	expected := []validationIssue{
+		{Path: "age", File: "data/base/data.yaml", Line: 2},
+		{Path: "passwords.0", File: "data/overlays/dev/data.yaml", Line: 3},
+		{Path: "network.cidr"},
+	}
+	if !reflect.DeepEqual(issues, expected) {
+		t.Errorf("expected issues %v, got %v", expected, issues)
+	}
+}
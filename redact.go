@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// redactedValue replaces secret values in output.
+const redactedValue = "[redacted]"
+
+// decryptedValues returns the strings of after that differ from the string at
+// the same place in before, i.e. the values decryption filled in secrets.
+func decryptedValues(before, after any) []string {
+	var secrets []string
+	var walk func(before, after any)
+	walk = func(before, after any) {
+		switch a := after.(type) {
+		case string:
+			if b, ok := before.(string); !ok || b != a {
+				secrets = append(secrets, a)
+			}
+		case []any:
+			b, _ := before.([]any)
+			for i, item := range a {
+				var previous any
+				if i < len(b) {
+					previous = b[i]
+				}
+				walk(previous, item)
+			}
+		default:
+			if m, ok := asMap(after); ok {
+				b, _ := asMap(before)
+				for key, item := range m {
+					walk(b[key], item)
+				}
+			}
+		}
+	}
+	walk(before, after)
+	return secrets
+}
+
+// redact replaces every secret in s by redactedValue, including the quoted and
+// JSON escaped forms of the secret that error messages use.
+func redact(s string, secrets []string) string {
+	for _, form := range redactionForms(secrets) {
+		s = strings.ReplaceAll(s, form, redactedValue)
+	}
+	return s
+}
+
+// redactionForms returns the forms of the secrets redact replaces, longest
+// first, so a secret containing another is masked as a whole.
+func redactionForms(secrets []string) []string {
+	var forms []string
+	for _, secret := range secrets {
+		if len(secret) == 0 {
+			continue
+		}
+		forms = append(forms, secret, strings.Trim(strconv.Quote(secret), `"`))
+		if content, err := json.Marshal(secret); err == nil {
+			forms = append(forms, strings.Trim(string(content), `"`))
+		}
+	}
+	sort.Slice(forms, func(i, j int) bool { return len(forms[i]) > len(forms[j]) })
+	return forms
+}
+
+// secretTracker records the values decryptors returned, so output can mask
+// them wherever they end up.
+type secretTracker struct {
+	mu       sync.RWMutex
+	secrets  map[string]struct{}
+	replacer *strings.Replacer
+}
+
+// minTrackedSecretLength is the length below which secrets are not tracked.
+// Masking short values such as "1", "eu" or "dev" would garble every log line
+// they happen to occur in, e.g. in timestamps.
+const minTrackedSecretLength = 4
+
+// trackedSecrets holds the secrets decrypted in this run. Every log line is
+// redacted with it, see redactingSink.
+var trackedSecrets = newSecretTracker()
+
+func newSecretTracker() *secretTracker {
+	return &secretTracker{secrets: make(map[string]struct{})}
+}
+
+// track records secrets, values shorter than minTrackedSecretLength are
+// ignored.
+func (t *secretTracker) track(secrets ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	changed := false
+	for _, secret := range secrets {
+		if _, ok := t.secrets[secret]; ok || len(secret) < minTrackedSecretLength {
+			continue
+		}
+		t.secrets[secret] = struct{}{}
+		changed = true
+	}
+	if !changed {
+		return
+	}
+
+	all := make([]string, 0, len(t.secrets))
+	for secret := range t.secrets {
+		all = append(all, secret)
+	}
+	var pairs []string
+	for _, form := range redactionForms(all) {
+		pairs = append(pairs, form, redactedValue)
+	}
+	t.replacer = strings.NewReplacer(pairs...)
+}
+
+// redact replaces every tracked secret in s, like redact.
+func (t *secretTracker) redact(s string) string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.replacer == nil {
+		return s
+	}
+	return t.replacer.Replace(s)
+}
+
+// writer returns w masking the tracked secrets in every write, for output
+// written outside the logger such as reports and command errors.
+func (t *secretTracker) writer(w io.Writer) io.Writer {
+	return redactingWriter{Writer: w, tracker: t}
+}
+
+// redactingWriter masks the secrets of a tracker in everything written to it.
+type redactingWriter struct {
+	io.Writer
+	tracker *secretTracker
+}
+
+func (w redactingWriter) Write(p []byte) (int, error) {
+	if _, err := w.Writer.Write([]byte(w.tracker.redact(string(p)))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// redactedSinkScheme is the zap sink scheme of redactingSink, as in
+// redacted:stderr.
+const redactedSinkScheme = "redacted"
+
+// redactingSink is a zap sink masking the secrets of a tracker in every log
+// entry written to it. Masking the encoded entries covers every logger call,
+// whatever the fields hold.
+type redactingSink struct {
+	zapcore.WriteSyncer
+	tracker *secretTracker
+}
+
+func (s redactingSink) Write(p []byte) (int, error) {
+	return s.tracker.writer(s.WriteSyncer).Write(p)
+}
+
+// Close does nothing, the standard streams stay open.
+func (s redactingSink) Close() error {
+	return nil
+}
+
+func init() {
+	err := zap.RegisterSink(redactedSinkScheme, func(u *url.URL) (zap.Sink, error) {
+		switch u.Opaque {
+		case "stderr":
+			return redactingSink{WriteSyncer: os.Stderr, tracker: trackedSecrets}, nil
+		case "stdout":
+			return redactingSink{WriteSyncer: os.Stdout, tracker: trackedSecrets}, nil
+		}
+		return nil, fmt.Errorf("unsupported redacted log output %q, expected stderr or stdout", u.Opaque)
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// redactError returns err with every secret in its message and issues
+// redacted. Issues lose their values, which may be secrets themselves.
+func redactError(err error, secrets []string) error {
+	var validationErr *validationError
+	if !errors.As(err, &validationErr) {
+		return errors.New(redact(err.Error(), secrets))
+	}
+
+	issues := make([]validationIssue, len(validationErr.Issues))
+	for i, issue := range validationErr.Issues {
+		issue.Message = redact(issue.Message, secrets)
+		issue.Constraint = redact(issue.Constraint, secrets)
+		issue.Value = nil
+		issues[i] = issue
+	}
+	return &validationError{Issues: issues}
+}
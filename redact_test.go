@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestDecryptedValues(t *testing.T) {
+	before := Data{
+		"name":     "app",
+		"password": "$$db$$",
+		"url":      "postgres://app:$$db$$@db",
+		"list":     []any{"plain", "$$token$$"},
+		"nested":   map[string]any{"key": "$$key$$", "port": uint64(5432)},
+	}
+	after := Data{
+		"name":     "app",
+		"password": "hunter2",
+		"url":      "postgres://app:hunter2@db",
+		"list":     []any{"plain", "t0ken"},
+		"nested":   Data{"key": "k3y", "port": uint64(5432)},
+	}
+
+	secrets := decryptedValues(before, after)
+	sort.Strings(secrets)
+	expected := []string{"hunter2", "k3y", "postgres://app:hunter2@db", "t0ken"}
+	if !reflect.DeepEqual(secrets, expected) {
+		t.Errorf("expected secrets %v, got %v", expected, secrets)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	secrets := []string{"hunter2", `pa"ss`, "", "hunter2-long"}
+
+	tests := map[string]string{
+		`invalid value "hunter2"`:      `invalid value "[redacted]"`,
+		`invalid value "pa\"ss"`:       `invalid value "[redacted]"`,
+		"hunter2-long and hunter2":     "[redacted] and [redacted]",
+		"nothing secret in this value": "nothing secret in this value",
+	}
+	for input, expected := range tests {
+		if got := redact(input, secrets); got != expected {
+			t.Errorf("redact(%q): expected %q, got %q", input, expected, got)
+		}
+	}
+}
+
+func TestValidateDecryptedData(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "schema.cue"), "import \"strings\"\n\n#Schema: {\n\tname: string\n\tpassword: string & strings.MinRunes(12)\n}\n")
+
+	defer func(previous string) { secretSchemaPath = previous }(secretSchemaPath)
+	secretSchemaPath = filepath.Join(dir, "schema.cue")
+
+	encrypted := Data{"name": "app", "password": "$$db$$"}
+
+	validated, err := validateDecryptedData(encrypted, Data{"name": "app", "password": "correct-horse-battery"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if validated["password"] != "correct-horse-battery" {
+		t.Errorf("expected the decrypted password, got %v", validated["password"])
+	}
+
+	_, err = validateDecryptedData(encrypted, Data{"name": "app", "password": "hunter2"})
+	var validationErr *validationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	if len(validationErr.Issues) != 1 || validationErr.Issues[0].Path != "password" {
+		t.Fatalf("expected one issue at password, got %+v", validationErr.Issues)
+	}
+	issue := validationErr.Issues[0]
+	if issue.Value != nil {
+		t.Errorf("expected the value to be dropped, got %v", issue.Value)
+	}
+	if strings.Contains(err.Error(), "hunter2") || !strings.Contains(issue.Message, redactedValue) {
+		t.Errorf("expected the secret to be redacted, got %q", issue.Message)
+	}
+}
+
+func TestSecretTracker(t *testing.T) {
+	tracker := newSecretTracker()
+	if s := tracker.redact("password hunter2"); s != "password hunter2" {
+		t.Errorf("expected nothing to be redacted without secrets, got %q", s)
+	}
+
+	tracker.track("hunter2", "", `pa"ss`)
+	tracker.track("hunter2-long")
+	tests := map[string]string{
+		"password hunter2":        "password [redacted]",
+		"password hunter2-long":   "password [redacted]",
+		`{"password":"pa\"ss"}`:   `{"password":"[redacted]"}`,
+		"nothing secret in here":  "nothing secret in here",
+		"hunter2 and hunter2-lon": "[redacted] and [redacted]-lon",
+	}
+	for input, expected := range tests {
+		if s := tracker.redact(input); s != expected {
+			t.Errorf("%s: expected %q, got %q", input, expected, s)
+		}
+	}
+
+	var buf bytes.Buffer
+	n, err := tracker.writer(&buf).Write([]byte("password hunter2\n"))
+	if err != nil || n != len("password hunter2\n") || buf.String() != "password [redacted]\n" {
+		t.Errorf("expected the writer to mask the secret, got %q, %d, %v", buf.String(), n, err)
+	}
+}
+
+func TestSecretTracker_ShortSecrets(t *testing.T) {
+	defer func(tracker *secretTracker) { trackedSecrets = tracker }(trackedSecrets)
+	trackedSecrets = newSecretTracker()
+
+	t.Setenv("DINGO_SECRET_FLAG", "1")
+	t.Setenv("DINGO_SECRET_REGION", "eu")
+	t.Setenv("DINGO_SECRET_TOKEN", "t0k3n")
+	data := Data{"flag": "$$env:flag$$", "region": "$$env:region$$", "token": "$$env:token$$"}
+	if err := decryptSecrets(&data, newSecretRouter("", nil)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Values too short to mask are not tracked
+	expected := `2026-10-17T23:34:03.365Z eu {"issues": 1} ` + redactedValue
+	if s := trackedSecrets.redact(`2026-10-17T23:34:03.365Z eu {"issues": 1} t0k3n`); s != expected {
+		t.Errorf("expected %q, got %q", expected, s)
+	}
+}
+
+func TestRedactingSink(t *testing.T) {
+	defer func(previous bool) { debug = previous }(debug)
+
+	tracker := newSecretTracker()
+	tracker.track("hunter2", "multi\nline")
+	var buf bytes.Buffer
+	sink := redactingSink{WriteSyncer: zapcore.AddSync(&buf), tracker: tracker}
+
+	for _, encoder := range []zapcore.Encoder{
+		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+		zapcore.NewConsoleEncoder(zap.NewDevelopmentEncoderConfig()),
+	} {
+		buf.Reset()
+		log := zap.New(zapcore.NewCore(encoder, sink, zapcore.DebugLevel))
+
+		debug = true
+		log.Error("templating failed for hunter2",
+			zap.Error(errors.New(`invalid value "hunter2"`)),
+			dataField(Data{"password": "hunter2", "key": "multi\nline", "name": "app"}),
+		)
+		output := buf.String()
+		if strings.Contains(output, "hunter2") || strings.Contains(output, `multi\nline`) {
+			t.Errorf("expected the secrets to be masked, got %s", output)
+		}
+		if !strings.Contains(output, redactedValue) || !strings.Contains(output, "app") {
+			t.Errorf("expected the data with masked secrets, got %s", output)
+		}
+
+		buf.Reset()
+		debug = false
+		log.Info("data loaded", dataField(Data{"name": "app"}))
+		if strings.Contains(buf.String(), "app") {
+			t.Errorf("expected no data without debug, got %s", buf.String())
+		}
+	}
+}
+
+func TestNewLogger(t *testing.T) {
+	if _, err := newLogger(zap.NewProductionConfig()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cfg := zap.NewProductionConfig()
+	cfg.OutputPaths = []string{redactedSinkScheme + ":/var/log/dingo.log"}
+	if _, err := cfg.Build(); err == nil || !strings.Contains(err.Error(), "unsupported redacted log output") {
+		t.Errorf("expected an unsupported output error, got %v", err)
+	}
+}
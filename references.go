@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// referencePattern matches ${path} references to other values of the merged
+// data. A leading backslash escapes the reference.
+var referencePattern = regexp.MustCompile(`(\\?)\$\{([^}]*)\}`)
+
+// referenceResolver resolves the references of a data tree in place.
+type referenceResolver struct {
+	data Data
+	// resolved holds the paths whose references are resolved.
+	resolved map[string]bool
+	// visiting is the chain of paths currently being resolved, used to
+	// detect cycles.
+	visiting []string
+}
+
+// resolveReferences replaces every ${path} reference in the values of data by
+// the value at path. A value consisting of a single reference keeps the type
+// of the referenced value, references inside a longer string are formatted
+// into it.
+func resolveReferences(data Data) error {
+	r := &referenceResolver{data: data, resolved: make(map[string]bool)}
+	_, err := r.resolveValue(data, nil)
+	return err
+}
+
+// resolveValue returns value, which lives at path, with its references
+// resolved. Maps and lists are updated in place.
+func (r *referenceResolver) resolveValue(value any, path []string) (any, error) {
+	key := joinPath(path)
+	if r.resolved[key] {
+		return value, nil
+	}
+	if slices.Contains(r.visiting, key) {
+		return nil, fmt.Errorf("reference cycle detected: %s", strings.Join(append(r.visiting[slices.Index(r.visiting, key):], key), " -> "))
+	}
+	r.visiting = append(r.visiting, key)
+	defer func() { r.visiting = r.visiting[:len(r.visiting)-1] }()
+
+	var err error
+	switch v := value.(type) {
+	case string:
+		value, err = r.resolveString(v, key)
+	case Data:
+		err = r.resolveMap(v, path)
+	case map[string]any:
+		err = r.resolveMap(v, path)
+	case []any:
+		for i, item := range v {
+			if v[i], err = r.resolveValue(item, append(slices.Clip(path), strconv.Itoa(i))); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r.resolved[key] = true
+	return value, nil
+}
+
+func (r *referenceResolver) resolveMap(m map[string]any, path []string) error {
+	for k, item := range m {
+		resolved, err := r.resolveValue(item, append(slices.Clip(path), k))
+		if err != nil {
+			return err
+		}
+		m[k] = resolved
+	}
+	return nil
+}
+
+// resolveString resolves the references in s, the value at key.
+func (r *referenceResolver) resolveString(s, key string) (any, error) {
+	matches := referencePattern.FindAllStringSubmatchIndex(s, -1)
+	if len(matches) == 0 {
+		return s, nil
+	}
+
+	// A single reference keeps the type of the referenced value
+	if len(matches) == 1 && matches[0][0] == 0 && matches[0][1] == len(s) && matches[0][3] == matches[0][2] {
+		value, err := r.lookup(s[matches[0][4]:matches[0][5]], key)
+		if err != nil {
+			return nil, err
+		}
+		return copyValue(value), nil
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, match := range matches {
+		b.WriteString(s[last:match[0]])
+		last = match[1]
+
+		// Escaped references are kept without the backslash
+		if match[3] > match[2] {
+			b.WriteString(s[match[2]+1 : match[1]])
+			continue
+		}
+
+		value, err := r.lookup(s[match[4]:match[5]], key)
+		if err != nil {
+			return nil, err
+		}
+		switch value.(type) {
+		case nil, Data, map[string]any, []any:
+			return nil, fmt.Errorf("%s: can not interpolate %s of type %T into a string", key, s[match[0]:match[1]], value)
+		}
+		b.WriteString(fmt.Sprint(value))
+	}
+	b.WriteString(s[last:])
+	return b.String(), nil
+}
+
+// lookup returns the resolved value at the dotted path ref, referenced from
+// the value at key. List elements are addressed by their index.
+func (r *referenceResolver) lookup(ref, key string) (any, error) {
+	path := strings.Split(strings.TrimSpace(ref), ".")
+
+	var parent any = r.data
+	var value any = r.data
+	for i, segment := range path {
+		parent = value
+		found := false
+		switch v := value.(type) {
+		case Data:
+			value, found = v[segment]
+		case map[string]any:
+			value, found = v[segment]
+		case []any:
+			index, err := strconv.Atoi(segment)
+			if err == nil && index >= 0 && index < len(v) {
+				value, found = v[index], true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%s: unknown reference ${%s}, %s does not exist", key, ref, joinPath(path[:i+1]))
+		}
+	}
+
+	resolved, err := r.resolveValue(value, path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Store the resolved value, so it is only resolved once
+	last := path[len(path)-1]
+	switch p := parent.(type) {
+	case Data:
+		p[last] = resolved
+	case map[string]any:
+		p[last] = resolved
+	case []any:
+		index, _ := strconv.Atoi(last)
+		p[index] = resolved
+	}
+	return resolved, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolveReferences(t *testing.T) {
+	data := Data{
+		"network": map[string]any{
+			"cidr":    "10.0.0.0/16",
+			"gateway": "${network.prefix}.1",
+			"prefix":  "10.0.0",
+		},
+		"firewall": map[string]any{
+			"allow":   "${network.cidr}",
+			"ports":   "${ports}",
+			"first":   "${ports.0}",
+			"comment": "allow ${network.cidr} on ${ports.1} (\\${not.a.reference})",
+		},
+		"ports":    []any{80, 443},
+		"network2": "${network}",
+	}
+
+	if err := resolveReferences(data); err != nil {
+		t.Fatalf("resolveReferences returned error: %v", err)
+	}
+
+	expected := Data{
+		"network": map[string]any{
+			"cidr":    "10.0.0.0/16",
+			"gateway": "10.0.0.1",
+			"prefix":  "10.0.0",
+		},
+		"firewall": map[string]any{
+			"allow":   "10.0.0.0/16",
+			"ports":   []any{80, 443},
+			"first":   80,
+			"comment": "allow 10.0.0.0/16 on 443 (${not.a.reference})",
+		},
+		"ports": []any{80, 443},
+		"network2": map[string]any{
+			"cidr":    "10.0.0.0/16",
+			"gateway": "10.0.0.1",
+			"prefix":  "10.0.0",
+		},
+	}
+	if !reflect.DeepEqual(data, expected) {
+		t.Errorf("expected %v, got %v", expected, data)
+	}
+}
+
+func TestResolveReferences_Errors(t *testing.T) {
+	testCases := []struct {
+		name        string
+		data        Data
+		expectedErr string
+	}{
+		{
+			name:        "cycle",
+			data:        Data{"a": "${b}", "b": map[string]any{"c": "x-${a}"}},
+			expectedErr: "reference cycle detected",
+		},
+		{
+			name:        "self_reference",
+			data:        Data{"a": "${a}"},
+			expectedErr: "reference cycle detected: a -> a",
+		},
+		{
+			name:        "unknown_reference",
+			data:        Data{"a": "${network.cidr}", "network": map[string]any{}},
+			expectedErr: "a: unknown reference ${network.cidr}, network.cidr does not exist",
+		},
+		{
+			name:        "map_in_string",
+			data:        Data{"a": "x-${network}", "network": map[string]any{}},
+			expectedErr: "can not interpolate ${network}",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := resolveReferences(tc.data)
+			if err == nil {
+				t.Fatal("expected an error, but got nil")
+			}
+			if !strings.Contains(err.Error(), tc.expectedErr) {
+				t.Errorf("expected error to contain %q, got %q", tc.expectedErr, err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"cuelang.org/go/cue"
+	cueerrors "cuelang.org/go/cue/errors"
+	"cuelang.org/go/cue/format"
+)
+
+// validationIssue is one violation found while validating data.
+type validationIssue struct {
+	// Path is the dotted key path of the offending value.
+	Path    string `json:"path"`
+	Message string `json:"message"`
+	// Constraint is the schema constraint at Path, if known.
+	Constraint string `json:"constraint,omitempty"`
+	// Value is the offending value, if the data has one at Path.
+	Value any    `json:"value,omitempty"`
+	File  string `json:"file,omitempty"`
+	Line  int    `json:"line,omitempty"`
+	// Rule is the policy rule that found the issue, empty for schema issues.
+	Rule string `json:"rule,omitempty"`
+	// Severity is error or warning. Schema issues are always errors.
+	Severity string `json:"severity,omitempty"`
+}
+
+// isWarning reports whether the issue does not fail validation.
+func (i validationIssue) isWarning() bool {
+	return i.Severity == string(policyWarning)
+}
+
+// countErrors returns the number of issues that fail validation.
+func countErrors(issues []validationIssue) int {
+	count := 0
+	for _, issue := range issues {
+		if !issue.isWarning() {
+			count++
+		}
+	}
+	return count
+}
+
+// validationError lists every issue of a failed validation.
+type validationError struct {
+	Issues []validationIssue
+}
+
+func (e *validationError) Error() string {
+	messages := make([]string, len(e.Issues))
+	for i, issue := range e.Issues {
+		messages[i] = fmt.Sprintf("%s: %s", issue.Path, issue.Message)
+	}
+	return strings.Join(messages, "\n")
+}
+
+// newValidationError converts the error of validating data against schema
+// into a validationError with one issue per CUE error.
+func newValidationError(err error, schema cue.Value, data Data) error {
+	var issues []validationIssue
+	for _, e := range cueerrors.Errors(err) {
+		path := e.Path()
+		// Drop the schema definition, e.g. #Schema
+		if len(path) > 0 && strings.HasPrefix(path[0], "#") {
+			path = path[1:]
+		}
+
+		msg, args := e.Msg()
+		issue := validationIssue{
+			Path:       joinPath(path),
+			Message:    fmt.Sprintf(msg, args...),
+			Constraint: schemaConstraint(schema, path),
+		}
+		if value, ok := valueAt(data, path); ok {
+			issue.Value = value
+		}
+		issues = append(issues, issue)
+	}
+	if len(issues) == 0 {
+		return err
+	}
+	return &validationError{Issues: issues}
+}
+
+// schemaConstraint formats the constraint schema places on path, trying
+// regular, optional and pattern fields. It is empty if the schema has none.
+func schemaConstraint(schema cue.Value, path []string) string {
+	value := schema
+	for _, segment := range path {
+		selectors := []cue.Selector{cue.Str(segment), cue.Str(segment).Optional(), cue.Str(segment).Required(), cue.AnyString}
+		if index, err := strconv.Atoi(segment); err == nil {
+			selectors = []cue.Selector{cue.Index(index), cue.AnyIndex}
+		}
+
+		found := false
+		for _, selector := range selectors {
+			if next := value.LookupPath(cue.MakePath(selector)); next.Exists() {
+				value, found = next, true
+				break
+			}
+		}
+		if !found {
+			return ""
+		}
+	}
+
+	constraint, err := format.Node(value.Syntax(cue.Raw()))
+	if err != nil {
+		return ""
+	}
+	return string(constraint)
+}
+
+// valueAt returns the value at path in data. List elements are addressed by
+// their index.
+func valueAt(data Data, path []string) (any, bool) {
+	var value any = data
+	for _, segment := range path {
+		found := false
+		switch v := value.(type) {
+		case Data:
+			value, found = v[segment]
+		case map[string]any:
+			value, found = v[segment]
+		case []any:
+			index, err := strconv.Atoi(segment)
+			if err == nil && index >= 0 && index < len(v) {
+				value, found = v[index], true
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// locate fills in the file and line that set the value of every issue. Values
+// from encrypted files are dropped from the issues and redacted from their
+// messages.
+func (p provenance) locate(issues []validationIssue) {
+	for i := range issues {
+		origins, ok := p.lookup(issues[i].Path)
+		if !ok {
+			continue
+		}
+		winner := origins[len(origins)-1]
+		issues[i].File = winner.File
+		issues[i].Line = winner.Line
+		if winner.Secret {
+			issues[i].Message = redact(issues[i].Message, decryptedValues(nil, issues[i].Value))
+			issues[i].Value = nil
+		}
+	}
+}
+
+// writeValidationReport writes the issues as JSON if logMode is json, and in
+// human form otherwise. Tracked secrets are masked.
+func writeValidationReport(w io.Writer, issues []validationIssue) error {
+	w = trackedSecrets.writer(w)
+	if logMode == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		return encoder.Encode(struct {
+			Valid  bool              `json:"valid"`
+			Issues []validationIssue `json:"issues"`
+		}{Valid: countErrors(issues) == 0, Issues: issues})
+	}
+
+	if len(issues) == 0 {
+		_, err := fmt.Fprintln(w, "validation passed")
+		return err
+	}
+
+	var b strings.Builder
+	failures := countErrors(issues)
+	warnings := len(issues) - failures
+	switch {
+	case failures == 0:
+		fmt.Fprintf(&b, "validation passed with %d warning(s):\n", warnings)
+	case warnings == 0:
+		fmt.Fprintf(&b, "validation failed with %d issue(s):\n", failures)
+	default:
+		fmt.Fprintf(&b, "validation failed with %d issue(s) and %d warning(s):\n", failures, warnings)
+	}
+	for _, issue := range issues {
+		fmt.Fprintf(&b, "\n  %s: %s\n", issue.Path, issue.Message)
+		if len(issue.Rule) > 0 {
+			fmt.Fprintf(&b, "    rule:       %s (%s)\n", issue.Rule, issue.Severity)
+		}
+		if len(issue.Constraint) > 0 {
+			fmt.Fprintf(&b, "    constraint: %s\n", strings.ReplaceAll(issue.Constraint, "\n", "\n                "))
+		}
+		if issue.Value != nil {
+			fmt.Fprintf(&b, "    value:      %s\n", formatValue(issue.Value))
+		}
+		if len(issue.File) > 0 {
+			source := issue.File
+			if issue.Line > 0 {
+				source = fmt.Sprintf("%s:%d", issue.File, issue.Line)
+			}
+			fmt.Fprintf(&b, "    source:     %s\n", source)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
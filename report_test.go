@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestValidateData_Issues(t *testing.T) {
+	_, err := validateData(Data{
+		"age":       177,
+		"passwords": []any{"$$secret$$", 1},
+		"network":   Data{"cidr": "10.0.0.1/16", "vpn_password": "$$vpn$$"},
+	})
+
+	var validationErr *validationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected a *validationError, got %v", err)
+	}
+
+	expected := []validationIssue{
+		{Path: "age", Message: "invalid value 177 (out of bound <=150)", Constraint: "int & <=150", Value: 177},
+		{Path: "passwords.1", Message: "conflicting values 1 and string (mismatched types int and string)", Constraint: "string", Value: 1},
+	}
+	if !reflect.DeepEqual(validationErr.Issues, expected) {
+		t.Errorf("expected issues %v, got %v", expected, validationErr.Issues)
+	}
+}
+
+func TestWriteValidationReport(t *testing.T) {
+	issues := []validationIssue{
+		{Path: "age", Message: "invalid value 177 (out of bound <=150)", Constraint: "int & <=150", Value: 177, File: "data/base/data.yaml", Line: 2},
+		{Path: "network.cidr", Message: "incomplete value string", Constraint: "string"},
+	}
+
+	defer func(previous string) { logMode = previous }(logMode)
+
+	logMode = "human"
+	var human bytes.Buffer
+	if err := writeValidationReport(&human, issues); err != nil {
+		t.Fatalf("writeValidationReport returned error: %v", err)
+	}
+	expected := `validation failed with 2 issue(s):
+
+  age: invalid value 177 (out of bound <=150)
+    constraint: int & <=150
+    value:      177
+    source:     data/base/data.yaml:2
+
+  network.cidr: incomplete value string
+    constraint: string
+`
+	if human.String() != expected {
+		t.Errorf("expected report %q, got %q", expected, human.String())
+	}
+
+	warnings := []validationIssue{
+		{Path: "debug", Message: "value true is not allowed", Value: true, Rule: "no-debug", Severity: "warning"},
+	}
+	human.Reset()
+	if err := writeValidationReport(&human, warnings); err != nil {
+		t.Fatalf("writeValidationReport returned error: %v", err)
+	}
+	expected = `validation passed with 1 warning(s):
+
+  debug: value true is not allowed
+    rule:       no-debug (warning)
+    value:      true
+`
+	if human.String() != expected {
+		t.Errorf("expected report %q, got %q", expected, human.String())
+	}
+
+	logMode = "json"
+	var out bytes.Buffer
+	if err := writeValidationReport(&out, issues); err != nil {
+		t.Fatalf("writeValidationReport returned error: %v", err)
+	}
+	var report struct {
+		Valid  bool              `json:"valid"`
+		Issues []validationIssue `json:"issues"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("report is not valid JSON: %v", err)
+	}
+	if report.Valid || len(report.Issues) != 2 || report.Issues[0].Line != 2 || report.Issues[1].Value != nil {
+		t.Errorf("unexpected JSON report %s", out.String())
+	}
+}
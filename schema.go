@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/load"
+)
+
+// schemaDefinition is the definition data is validated against.
+const schemaDefinition = "#Schema"
+
+// loadSchema returns the #Schema definition of the CUE schema at path. path
+// is a CUE file or a directory holding a CUE package, which may import other
+// packages of its module. Without a path the embedded schema is used.
+func loadSchema(ctx *cue.Context, path string) (cue.Value, error) {
+	name := path
+	var value cue.Value
+	if len(path) == 0 {
+		name = "embedded schema"
+		value = ctx.CompileString(schemaFile, cue.Filename("schema.cue"))
+	} else {
+		info, err := os.Stat(path)
+		if err != nil {
+			return cue.Value{}, fmt.Errorf("failed to read schema: %w", err)
+		}
+
+		config := &load.Config{Dir: path}
+		args := []string{"."}
+		if !info.IsDir() {
+			config.Dir = filepath.Dir(path)
+			args = []string{filepath.Base(path)}
+		}
+
+		instances := load.Instances(args, config)
+		if len(instances) != 1 {
+			return cue.Value{}, fmt.Errorf("schema %s must be a single CUE package, found %d", path, len(instances))
+		}
+		if err := instances[0].Err; err != nil {
+			return cue.Value{}, fmt.Errorf("failed to load schema %s: %w", path, err)
+		}
+		value = ctx.BuildInstance(instances[0])
+	}
+	if err := value.Err(); err != nil {
+		return cue.Value{}, fmt.Errorf("failed to compile %s: %w", name, err)
+	}
+
+	schema := value.LookupPath(cue.ParsePath(schemaDefinition))
+	if !schema.Exists() {
+		return cue.Value{}, fmt.Errorf("%s does not define %s", name, schemaDefinition)
+	}
+	return schema, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cuelang.org/go/cue/cuecontext"
+)
+
+func TestLoadSchema_Embedded(t *testing.T) {
+	schema, err := loadSchema(cuecontext.New(), "")
+	if err != nil {
+		t.Fatalf("loadSchema returned error: %v", err)
+	}
+	if !schema.Exists() {
+		t.Error("expected the embedded #Schema to exist")
+	}
+}
+
+func TestLoadSchema_File(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "schema.cue"), "#Schema: {\n\tname: string\n}\n")
+	writeTestFile(t, filepath.Join(dir, "other.cue"), "#Schema: {\n\tage: int\n}\n")
+
+	defer func(previous string) { schemaPath = previous }(schemaPath)
+	schemaPath = filepath.Join(dir, "schema.cue")
+
+	// Only the given file is loaded, so age is not allowed
+	if _, err := validateData(Data{"name": "vpc"}); err != nil {
+		t.Fatalf("validateData returned error: %v", err)
+	}
+	if _, err := validateData(Data{"name": "vpc", "age": 3}); err == nil {
+		t.Error("expected an error for a field of another file, but got nil")
+	}
+}
+
+func TestLoadSchema_PackageWithImports(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "cue.mod", "module.cue"), "module: \"example.com/infra\"\nlanguage: version: \"v0.12.0\"\n")
+	writeTestFile(t, filepath.Join(dir, "network", "network.cue"), "package network\n\n#Network: {\n\tcidr: string\n}\n")
+	writeTestFile(t, filepath.Join(dir, "schema", "schema.cue"), "package schema\n\nimport net \"example.com/infra/network\"\n\n#Schema: {\n\tname:    string\n\tnetwork: net.#Network\n}\n")
+	writeTestFile(t, filepath.Join(dir, "schema", "defaults.cue"), "package schema\n\n#Schema: {\n\treplicas: *2 | int\n}\n")
+
+	defer func(previous string) { schemaPath = previous }(schemaPath)
+	schemaPath = filepath.Join(dir, "schema")
+
+	validated, err := validateData(Data{"name": "vpc", "network": Data{"cidr": "10.0.0.0/16"}})
+	if err != nil {
+		t.Fatalf("validateData returned error: %v", err)
+	}
+	if validated["replicas"] != int64(2) {
+		t.Errorf("expected replicas default from defaults.cue, got %v", validated["replicas"])
+	}
+
+	if _, err := validateData(Data{"name": "vpc", "network": Data{"cidr": 3}}); err == nil {
+		t.Error("expected an error for an invalid imported definition, but got nil")
+	}
+}
+
+func TestLoadSchema_MissingDefinition(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "schema.cue"), "#Other: {}\n")
+
+	_, err := loadSchema(cuecontext.New(), filepath.Join(dir, "schema.cue"))
+	if err == nil {
+		t.Fatal("expected an error due to the missing #Schema, but got nil")
+	}
+	if !strings.Contains(err.Error(), "does not define #Schema") {
+		t.Errorf("expected missing definition error, got %q", err.Error())
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/alxndr13/dingo/decrypt"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// ageScheme is the scheme of age encrypted secret references.
+const ageScheme = "age"
+
+// encryptSecret encrypts plaintext with age for the recipients and the
+// recipients in the recipient files, and returns the $$age:<ciphertext>$$
+// secret reference.
+func encryptSecret(plaintext string, recipients []string, recipientFiles []string) (string, error) {
+	parsed, err := decrypt.ParseAgeRecipients(recipients...)
+	if err != nil {
+		return "", err
+	}
+	for _, path := range recipientFiles {
+		fromFile, err := decrypt.ReadAgeRecipientsFile(path)
+		if err != nil {
+			return "", err
+		}
+		parsed = append(parsed, fromFile...)
+	}
+	if len(parsed) == 0 {
+		return "", fmt.Errorf("no recipients, set --recipient or --recipients-file")
+	}
+
+	ciphertext, err := decrypt.EncryptAge(plaintext, parsed...)
+	if err != nil {
+		return "", err
+	}
+	return "$$" + ageScheme + ":" + ciphertext + "$$", nil
+}
+
+// decryptSecret decrypts an age secret reference with the identities of
+// identityFile. The reference may be given with or without the $$ and the
+// scheme.
+func decryptSecret(reference string, identityFile string) (string, error) {
+	ciphertext := strings.TrimSuffix(strings.TrimPrefix(reference, "$$"), "$$")
+	ciphertext = strings.TrimPrefix(ciphertext, ageScheme+":")
+
+	decryptor := decrypt.NewAgeDecryptor()
+	decryptor.IdentityFile = identityFile
+	if err := decryptor.Init(); err != nil {
+		return "", err
+	}
+	return decryptor.Decrypt(ciphertext)
+}
+
+// readSecretInput returns the first argument, or standard input without its
+// trailing newline if there is none.
+func readSecretInput(cmd *cobra.Command, args []string) (string, error) {
+	if len(args) > 0 {
+		return args[0], nil
+	}
+	content, err := io.ReadAll(cmd.InOrStdin())
+	if err != nil {
+		return "", fmt.Errorf("failed to read standard input: %w", err)
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(string(content), "\n"), "\r"), nil
+}
+
+// newSecretCmd returns the command grouping secret tooling.
+func newSecretCmd() *cobra.Command {
+	secretCmd := &cobra.Command{
+		Use:   "secret",
+		Short: "Secret tooling",
+	}
+
+	var recipients, recipientFiles []string
+	encryptCmd := &cobra.Command{
+		Use:   "encrypt [value]",
+		Short: "Encrypts a value with age into a secret reference",
+		Long: `Encrypts a value with age into a secret reference.
+
+The value is read from standard input if it is not given as argument. The
+printed $$age:<ciphertext>$$ reference can be committed to the data files, it
+is decrypted by the age decryptor with the identity of any recipient.`,
+		Example: `  dingo secret encrypt -r age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p s3cr3t
+  dingo secret encrypt -R .age-recipients < password.txt`,
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			plaintext, err := readSecretInput(cmd, args)
+			if err != nil {
+				logger.Error("failed to read secret",
+					zap.Error(err),
+				)
+				os.Exit(1)
+			}
+			// Mask the value in errors
+			trackedSecrets.track(plaintext)
+
+			reference, err := encryptSecret(plaintext, recipients, recipientFiles)
+			if err != nil {
+				logger.Error("failed to encrypt secret",
+					zap.Error(err),
+				)
+				os.Exit(1)
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), reference)
+		},
+	}
+	encryptCmd.Flags().StringArrayVarP(&recipients, "recipient", "r", nil, "age recipient to encrypt for, can be repeated")
+	encryptCmd.Flags().StringArrayVarP(&recipientFiles, "recipients-file", "R", nil, "File of age recipients to encrypt for, one per line, can be repeated")
+
+	var identityFile string
+	decryptCmd := &cobra.Command{
+		Use:   "decrypt [reference]",
+		Short: "Decrypts an age secret reference",
+		Long: `Decrypts an age secret reference.
+
+The reference is read from standard input if it is not given as argument. The
+identity file defaults to DINGO_AGE_IDENTITY_FILE, falling back to
+SOPS_AGE_KEY_FILE.`,
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			reference, err := readSecretInput(cmd, args)
+			if err != nil {
+				logger.Error("failed to read secret",
+					zap.Error(err),
+				)
+				os.Exit(1)
+			}
+
+			plaintext, err := decryptSecret(strings.TrimSpace(reference), identityFile)
+			if err != nil {
+				logger.Error("failed to decrypt secret",
+					zap.Error(err),
+				)
+				os.Exit(1)
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), plaintext)
+		},
+	}
+	decryptCmd.Flags().StringVarP(&identityFile, "identity", "i", "", "age identity file to decrypt with")
+
+	secretCmd.AddCommand(encryptCmd, decryptCmd)
+	return secretCmd
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/alxndr13/dingo/decrypt"
+)
+
+// secretSchemes maps secret reference schemes to the decryptor resolving
+// them, for schemes that differ from the decryptor name. Set by initConfig
+// from secrets.schemes.
+var secretSchemes = map[string]string{}
+
+// defaultSecretSchemes are the built-in scheme aliases.
+var defaultSecretSchemes = map[string]string{
+	"gsm": "google",
+}
+
+// secretSchemePattern matches the scheme prefix of a secret reference.
+var secretSchemePattern = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// secretCallPolicy bounds and retries the calls of every decryptor. Set by
+// initConfig from secrets.timeout, secrets.retries, secrets.backoff and
+// secrets.max_backoff.
+var secretCallPolicy = decrypt.DefaultCallPolicy
+
+// secretRouter is a Decryptor routing scheme prefixed references, such as
+// $$vault:kv/app#password$$, to the decryptor of their scheme. References
+// without a known scheme go to the default decryptor, and are kept as they
+// are if there is none. Every decryptor is created and initialised once, and
+// its calls follow secretCallPolicy. Decrypted values are tracked in
+// trackedSecrets, to mask them in the logs.
+type secretRouter struct {
+	defaultName string
+	schemes     map[string]string
+	policy      decrypt.CallPolicy
+
+	mu         sync.Mutex
+	decryptors map[string]*lazyDecryptor
+	// schemeDecryptors caches whether a scheme names a decryptor, as looking
+	// for a plugin searches the PATH.
+	schemeDecryptors map[string]bool
+	// decrypted is set once a reference was resolved.
+	decrypted atomic.Bool
+}
+
+// lazyDecryptor is a decryptor of the router, initialised on first use.
+type lazyDecryptor struct {
+	once      sync.Once
+	decryptor decrypt.ContextDecryptor
+	err       error
+}
+
+func newSecretRouter(defaultName string, schemes map[string]string) *secretRouter {
+	return &secretRouter{defaultName: defaultName, schemes: schemes, policy: secretCallPolicy, decryptors: make(map[string]*lazyDecryptor), schemeDecryptors: make(map[string]bool)}
+}
+
+// Init does nothing, decryptors are initialised on first use.
+func (r *secretRouter) Init() error {
+	return nil
+}
+
+func (r *secretRouter) Decrypt(secretName string) (string, error) {
+	return r.DecryptContext(context.Background(), secretName)
+}
+
+// InitContext does nothing, decryptors are initialised on first use.
+func (r *secretRouter) InitContext(ctx context.Context) error {
+	return nil
+}
+
+func (r *secretRouter) DecryptContext(ctx context.Context, secretName string) (string, error) {
+	name, secret := r.route(secretName)
+	if len(name) == 0 {
+		return "$$" + secretName + "$$", nil
+	}
+
+	decryptor, err := r.decryptor(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	value, err := decryptor.DecryptContext(ctx, secret)
+	if err != nil {
+		return "", err
+	}
+	r.decrypted.Store(true)
+	trackedSecrets.track(value)
+	return value, nil
+}
+
+// route returns the name of the decryptor for a reference and the secret name
+// to pass on to it. The name is empty if no decryptor resolves the reference.
+func (r *secretRouter) route(ref string) (string, string) {
+	if scheme, secret, ok := strings.Cut(ref, ":"); ok && secretSchemePattern.MatchString(scheme) {
+		if name, ok := r.schemes[scheme]; ok {
+			return name, secret
+		}
+		if name, ok := defaultSecretSchemes[scheme]; ok {
+			return name, secret
+		}
+		if r.isDecryptor(scheme) {
+			return scheme, secret
+		}
+	}
+	return r.defaultName, ref
+}
+
+// isDecryptor reports whether a decryptor is called scheme, looking it up once
+// per scheme.
+func (r *secretRouter) isDecryptor(scheme string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	exists, ok := r.schemeDecryptors[scheme]
+	if !ok {
+		exists = decrypt.Exists(scheme)
+		r.schemeDecryptors[scheme] = exists
+	}
+	return exists
+}
+
+// decryptor returns the initialised decryptor called name. Concurrent calls
+// for the same name wait for a single initialisation.
+func (r *secretRouter) decryptor(ctx context.Context, name string) (decrypt.ContextDecryptor, error) {
+	r.mu.Lock()
+	routed, ok := r.decryptors[name]
+	if !ok {
+		routed = &lazyDecryptor{}
+		r.decryptors[name] = routed
+	}
+	r.mu.Unlock()
+
+	routed.once.Do(func() {
+		decryptor, err := initDecryptor(name)
+		if err != nil {
+			routed.err = err
+			return
+		}
+		routed.decryptor = decrypt.WithPolicy(decrypt.WithContext(decryptor), r.policy)
+		routed.err = routed.decryptor.InitContext(ctx)
+	})
+	if routed.err != nil {
+		return nil, routed.err
+	}
+	return routed.decryptor, nil
+}
+
+// Close closes every decryptor, e.g. to stop plugins.
+func (r *secretRouter) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var errs []error
+	for _, routed := range r.decryptors {
+		if routed.decryptor != nil {
+			errs = append(errs, routed.decryptor.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alxndr13/dingo/decrypt"
+)
+
+// routedDecryptor prefixes secret names with its name and counts Init and
+// Close calls.
+type routedDecryptor struct {
+	name   string
+	inits  int
+	closed bool
+}
+
+func (d *routedDecryptor) Init() error {
+	d.inits++
+	return nil
+}
+
+func (d *routedDecryptor) Decrypt(secretName string) (string, error) {
+	if secretName == "error" {
+		return "", errors.New("decryption failed")
+	}
+	return d.name + "/" + secretName, nil
+}
+
+func (d *routedDecryptor) Close() error {
+	d.closed = true
+	return nil
+}
+
+var (
+	routedDecryptorsMu sync.Mutex
+	routedDecryptors   = map[string]*routedDecryptor{}
+)
+
+func init() {
+	for _, name := range []string{"test-default", "test-vault"} {
+		decrypt.Register(name, func() decrypt.Decryptor {
+			d := &routedDecryptor{name: name}
+			routedDecryptorsMu.Lock()
+			routedDecryptors[name] = d
+			routedDecryptorsMu.Unlock()
+			return d
+		})
+	}
+}
+
+func TestSecretRouter(t *testing.T) {
+	data := Data{
+		"plain":    "$$db$$",
+		"scheme":   "$$test-vault:kv/app#password$$",
+		"alias":    "$$kv:kv/api#token$$",
+		"colon":    "$$unknown:thing$$",
+		"embedded": "postgres://app:$$test-vault:db$$@db",
+		"list":     []any{"$$test-vault:a$$", "$$test-vault:b$$"},
+	}
+	expected := Data{
+		"plain":    "test-default/db",
+		"scheme":   "test-vault/kv/app#password",
+		"alias":    "test-vault/kv/api#token",
+		"colon":    "test-default/unknown:thing",
+		"embedded": "postgres://app:test-vault/db@db",
+		"list":     []any{"test-vault/a", "test-vault/b"},
+	}
+
+	router := newSecretRouter("test-default", map[string]string{"kv": "test-vault"})
+	if err := decryptSecrets(&data, router); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(data, expected) {
+		t.Errorf("expected %v, got %v", expected, data)
+	}
+	if !router.decrypted.Load() {
+		t.Error("expected the router to report decrypted secrets")
+	}
+	if s := trackedSecrets.redact("password test-vault/kv/app#password"); s != "password "+redactedValue {
+		t.Errorf("expected decrypted values to be tracked, got %q", s)
+	}
+
+	// Every decryptor is initialised once
+	for name, d := range routedDecryptors {
+		if d.inits != 1 {
+			t.Errorf("expected %s to be initialised once, got %d", name, d.inits)
+		}
+	}
+
+	if err := router.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+	for name, d := range routedDecryptors {
+		if !d.closed {
+			t.Errorf("expected %s to be closed", name)
+		}
+	}
+}
+
+func TestSecretRouter_NoDefault(t *testing.T) {
+	data := Data{"plain": "$$db$$", "scheme": "$$test-vault:db$$"}
+	expected := Data{"plain": "$$db$$", "scheme": "test-vault/db"}
+
+	router := newSecretRouter("", nil)
+	if err := decryptSecrets(&data, router); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(data, expected) {
+		t.Errorf("expected %v, got %v", expected, data)
+	}
+}
+
+func TestSecretRouter_SchemeLookup(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PATH", dir)
+
+	router := newSecretRouter("test-default", nil)
+	if name, secret := router.route("late:db"); name != "test-default" || secret != "late:db" {
+		t.Errorf("expected an unknown scheme to go to the default decryptor, got %s, %s", name, secret)
+	}
+
+	// The lookup of a scheme is cached, a plugin installed later is not found
+	plugin := filepath.Join(dir, decrypt.PluginPrefix+"late")
+	if err := os.WriteFile(plugin, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatalf("failed to write plugin: %v", err)
+	}
+	if name, _ := router.route("late:db"); name != "test-default" {
+		t.Errorf("expected the cached lookup of late, got %s", name)
+	}
+	if name, _ := newSecretRouter("test-default", nil).route("late:db"); name != "late" {
+		t.Errorf("expected a new router to find the plugin, got %s", name)
+	}
+}
+
+func TestSecretRouter_Error(t *testing.T) {
+	router := newSecretRouter("", nil)
+
+	data := Data{"secret": "$$test-vault:error$$"}
+	err := decryptSecrets(&data, router)
+	if err == nil || err.Error() != "decryption failed" {
+		t.Errorf("expected the decryptor error, got %v", err)
+	}
+	if router.decrypted.Load() {
+		t.Error("expected no decrypted secrets")
+	}
+}
+
+// flakyDecryptor fails with a transient error on every first attempt of a
+// secret.
+type flakyDecryptor struct {
+	mu       sync.Mutex
+	attempts map[string]int
+}
+
+func (d *flakyDecryptor) Init() error {
+	return nil
+}
+
+func (d *flakyDecryptor) Decrypt(secretName string) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.attempts[secretName]++
+	if d.attempts[secretName] == 1 {
+		return "", decrypt.Transient(errors.New("unavailable"))
+	}
+	return "value of " + secretName, nil
+}
+
+func init() {
+	decrypt.Register("test-flaky", func() decrypt.Decryptor {
+		return &flakyDecryptor{attempts: map[string]int{}}
+	})
+}
+
+func TestSecretRouter_Retry(t *testing.T) {
+	defer func(previous decrypt.CallPolicy) { secretCallPolicy = previous }(secretCallPolicy)
+	secretCallPolicy = decrypt.CallPolicy{Timeout: time.Second, Retries: 1, Backoff: time.Millisecond}
+
+	data := Data{"a": "$$test-flaky:a$$", "b": "$$test-flaky:b$$"}
+	router := newSecretRouter("", nil)
+	if err := decryptSecrets(&data, router); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := Data{"a": "value of a", "b": "value of b"}
+	if !reflect.DeepEqual(data, expected) {
+		t.Errorf("expected %v, got %v", expected, data)
+	}
+
+	secretCallPolicy.Retries = 0
+	data = Data{"a": "$$test-flaky:a$$"}
+	if err := decryptSecrets(&data, newSecretRouter("", nil)); err == nil || err.Error() != "unavailable" {
+		t.Errorf("expected the transient error without retries, got %v", err)
+	}
+}
+
+func TestDecryptSecretsContext_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	data := Data{"secret": "$$test-vault:db$$"}
+	router := newSecretRouter("", nil)
+	err := decryptSecretsContext(ctx, &data, router)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a canceled error, got %v", err)
+	}
+	if router.decrypted.Load() || data["secret"] != "$$test-vault:db$$" {
+		t.Errorf("expected no secrets to be decrypted, got %v", data)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/getsops/sops/v3/cmd/sops/formats"
+	sopsdecrypt "github.com/getsops/sops/v3/decrypt"
+)
+
+// sopsMetadataKey is the top level key SOPS stores its metadata under.
+const sopsMetadataKey = "sops"
+
+// sopsFormats maps the data formats that can be SOPS encrypted to the format
+// names of SOPS.
+var sopsFormats = map[string]formats.Format{
+	"YAML": formats.Yaml,
+	"JSON": formats.Json,
+}
+
+// isSOPSEncrypted reports whether the decoded documents of a data file are a
+// SOPS encrypted file. SOPS writes its metadata into every document of a
+// multi-document YAML file, so either all documents carry it or none; a file
+// with only some encrypted documents is an error.
+func isSOPSEncrypted(decoder dataDecoder, documents []dataDocument) (bool, error) {
+	if _, ok := sopsFormats[decoder.format]; !ok {
+		return false, nil
+	}
+	encrypted := 0
+	for _, doc := range documents {
+		if hasSOPSMetadata(doc.data) {
+			encrypted++
+		}
+	}
+	switch encrypted {
+	case 0:
+		return false, nil
+	case len(documents):
+		return true, nil
+	}
+	return false, fmt.Errorf("%d of %d documents are SOPS encrypted, either all or none must be", encrypted, len(documents))
+}
+
+// hasSOPSMetadata reports whether data holds SOPS metadata with a MAC.
+func hasSOPSMetadata(data Data) bool {
+	metadata, ok := asMap(data[sopsMetadataKey])
+	if !ok {
+		return false
+	}
+	_, hasMAC := metadata["mac"]
+	return hasMAC
+}
+
+// decryptSOPS decrypts a SOPS encrypted data file and decodes the plaintext.
+// encrypted are the decoded documents of the encrypted file. Keys are looked
+// up the way the sops CLI does, e.g. age identities from SOPS_AGE_KEY_FILE and
+// PGP keys from the GnuPG keyring. The documents are marked as secret, and the
+// values that were encrypted are tracked to mask them in the logs; values kept
+// in plaintext, e.g. by unencrypted_suffix, are not.
+func decryptSOPS(decoder dataDecoder, content []byte, encrypted []dataDocument) ([]dataDocument, error) {
+	plaintext, err := sopsdecrypt.DataWithFormat(content, sopsFormats[decoder.format])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt SOPS file: %w", err)
+	}
+
+	documents, err := decoder.decode(plaintext)
+	if err != nil {
+		return nil, err
+	}
+	for i := range documents {
+		documents[i].secret = true
+		var before Data
+		if i < len(encrypted) {
+			before = encrypted[i].data
+		}
+		trackedSecrets.track(decryptedValues(before, documents[i].data)...)
+	}
+	return documents, nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/getsops/sops/v3"
+	"github.com/getsops/sops/v3/aes"
+	sopsage "github.com/getsops/sops/v3/age"
+	"github.com/getsops/sops/v3/cmd/sops/common"
+	"github.com/getsops/sops/v3/cmd/sops/formats"
+	"github.com/getsops/sops/v3/config"
+	"github.com/getsops/sops/v3/keyservice"
+	"github.com/getsops/sops/v3/version"
+)
+
+// newSOPSIdentity returns a new age identity and sets it as the identity
+// SOPS decrypts with.
+func newSOPSIdentity(t *testing.T) *age.X25519Identity {
+	t.Helper()
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("failed to generate age identity: %v", err)
+	}
+	t.Setenv(sopsage.SopsAgeKeyEnv, identity.String())
+	return identity
+}
+
+// encryptSOPS encrypts plaintext for identity like `sops --encrypt --age`
+// does. configure can change the metadata, e.g. to keep values in plaintext.
+func encryptSOPS(t *testing.T, identity *age.X25519Identity, format formats.Format, plaintext string, configure ...func(*sops.Metadata)) string {
+	t.Helper()
+
+	store := common.StoreForFormat(format, config.NewStoresConfig())
+	branches, err := store.LoadPlainFile([]byte(plaintext))
+	if err != nil {
+		t.Fatalf("failed to load plaintext: %v", err)
+	}
+	key, err := sopsage.MasterKeyFromRecipient(identity.Recipient().String())
+	if err != nil {
+		t.Fatalf("failed to create age master key: %v", err)
+	}
+
+	tree := sops.Tree{
+		Branches: branches,
+		Metadata: sops.Metadata{KeyGroups: []sops.KeyGroup{{key}}, Version: version.Version},
+	}
+	for _, f := range configure {
+		f(&tree.Metadata)
+	}
+	dataKey, errs := tree.GenerateDataKeyWithKeyServices([]keyservice.KeyServiceClient{keyservice.NewLocalClient()})
+	if len(errs) > 0 {
+		t.Fatalf("failed to generate data key: %v", errs)
+	}
+	if err := common.EncryptTree(common.EncryptTreeOpts{DataKey: dataKey, Tree: &tree, Cipher: aes.NewCipher()}); err != nil {
+		t.Fatalf("failed to encrypt: %v", err)
+	}
+	encrypted, err := store.EmitEncryptedFile(tree)
+	if err != nil {
+		t.Fatalf("failed to emit encrypted file: %v", err)
+	}
+	return string(encrypted)
+}
+
+func TestLoadAndMergeYAMLFiles_SOPS(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "base", "data.yaml"), "name: app\ndatabase:\n  host: db.local\n  password: $$db$$\n")
+	identity := newSOPSIdentity(t)
+	writeTestFile(t, filepath.Join(dir, "prod", "secrets.yaml"), encryptSOPS(t, identity, formats.Yaml, "database:\n  password: s3cr3t\n"))
+	writeTestFile(t, filepath.Join(dir, "prod", "api.json"), encryptSOPS(t, identity, formats.Json, `{"api": {"token": "t0ken"}}`))
+
+	merged, prov, err := loadAndTrackYAMLFiles(filepath.Join(dir, "base"), filepath.Join(dir, "prod"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := Data{
+		"name":     "app",
+		"database": Data{"host": "db.local", "password": "s3cr3t"},
+		"api":      map[string]any{"token": "t0ken"},
+	}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("expected merged data %v, got %v", expected, merged)
+	}
+
+	if s := trackedSecrets.redact("password t0ken"); s != "password "+redactedValue {
+		t.Errorf("expected SOPS values to be tracked, got %q", s)
+	}
+
+	origins, _ := prov.lookup("database.password")
+	if winner := origins[len(origins)-1]; !winner.Secret || winner.File != filepath.Join(dir, "prod", "secrets.yaml") {
+		t.Errorf("expected the password to be a secret from secrets.yaml, got %+v", winner)
+	}
+	if origins, _ := prov.lookup("database.host"); origins[0].Secret {
+		t.Error("expected values of plain files not to be secret")
+	}
+
+	var buf bytes.Buffer
+	if err := prov.explain(&buf, "database.password"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(buf.String(), "s3cr3t") || !strings.Contains(buf.String(), redactedValue) {
+		t.Errorf("expected the secret to be redacted, got:\n%s", buf.String())
+	}
+
+	issues := []validationIssue{{Path: "database.password", Message: `invalid value "s3cr3t"`, Value: "s3cr3t"}}
+	prov.locate(issues)
+	if issues[0].Value != nil || issues[0].Message != `invalid value "[redacted]"` {
+		t.Errorf("expected the secret to be dropped from the issue, got %+v", issues[0])
+	}
+}
+
+func TestLoadAndMergeYAMLFiles_SOPSTracked(t *testing.T) {
+	defer func(tracker *secretTracker) { trackedSecrets = tracker }(trackedSecrets)
+	trackedSecrets = newSecretTracker()
+
+	dir := t.TempDir()
+	plaintext := "region_unencrypted: eu-central-1\nenv: dev\npassword: s3cr3t\n"
+	writeTestFile(t, filepath.Join(dir, "base", "secrets.yaml"), encryptSOPS(t, newSOPSIdentity(t), formats.Yaml, plaintext, func(metadata *sops.Metadata) {
+		metadata.UnencryptedSuffix = "_unencrypted"
+	}))
+
+	if _, err := loadAndMergeYAMLFiles(filepath.Join(dir, "base")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Plaintext and short values are not tracked
+	expected := "eu-central-1 dev " + redactedValue
+	if s := trackedSecrets.redact("eu-central-1 dev s3cr3t"); s != expected {
+		t.Errorf("expected %q, got %q", expected, s)
+	}
+}
+
+func TestLoadAndMergeYAMLFiles_SOPSWithoutKey(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "base", "secrets.yaml"), encryptSOPS(t, newSOPSIdentity(t), formats.Yaml, "password: s3cr3t\n"))
+
+	// Decrypt with an unrelated identity
+	newSOPSIdentity(t)
+
+	_, err := loadAndMergeYAMLFiles(filepath.Join(dir, "base"))
+	if err == nil || !strings.Contains(err.Error(), "error decrypting") {
+		t.Errorf("expected a decryption error, got %v", err)
+	}
+}
+
+func TestLoadAndMergeYAMLFiles_SOPSMultiDocument(t *testing.T) {
+	dir := t.TempDir()
+	identity := newSOPSIdentity(t)
+	encrypted := encryptSOPS(t, identity, formats.Yaml, "database:\n  password: s3cr3t\n---\napi:\n  token: t0ken\n")
+	writeTestFile(t, filepath.Join(dir, "base", "secrets.yaml"), encrypted)
+
+	merged, err := loadAndMergeYAMLFiles(filepath.Join(dir, "base"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := Data{
+		"database": map[string]any{"password": "s3cr3t"},
+		"api":      map[string]any{"token": "t0ken"},
+	}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("expected merged data %v, got %v", expected, merged)
+	}
+
+	// A plain document next to encrypted ones is not merged as it is
+	writeTestFile(t, filepath.Join(dir, "mixed", "secrets.yaml"), encrypted+"---\nname: app\n")
+	_, err = loadAndMergeYAMLFiles(filepath.Join(dir, "mixed"))
+	if err == nil || !strings.Contains(err.Error(), "2 of 3 documents are SOPS encrypted") {
+		t.Errorf("expected an error for partly encrypted documents, got %v", err)
+	}
+}
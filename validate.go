@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// overlayResult is the outcome of validating the base merged with a set of
+// overlays.
+type overlayResult struct {
+	Overlay string            `json:"overlay"`
+	Valid   bool              `json:"valid"`
+	Issues  []validationIssue `json:"issues,omitempty"`
+	// Error is set if the data could not be loaded or validated at all.
+	Error string `json:"error,omitempty"`
+}
+
+// validateOverlays merges the base with the overlays, resolves references and
+// checks the result against the schema and the policy rules, like a render
+// does before decrypting secrets.
+func validateOverlays(overlays ...string) overlayResult {
+	result := overlayResult{Overlay: strings.Join(overlays, ",")}
+
+	mergedData, prov, err := loadAndTrackYAMLFiles(basePath, overlays...)
+	if err == nil {
+		err = resolveReferences(mergedData)
+	}
+	var warnings []validationIssue
+	if err == nil {
+		_, warnings, err = checkData(mergedData, overlays)
+	}
+
+	var validationErr *validationError
+	switch {
+	case err == nil:
+		prov.locate(warnings)
+		result.Valid = true
+		result.Issues = warnings
+	case errors.As(err, &validationErr):
+		prov.locate(validationErr.Issues)
+		result.Issues = validationErr.Issues
+	default:
+		result.Error = trackedSecrets.redact(err.Error())
+	}
+	return result
+}
+
+// writeValidationMatrix writes a summary of the results, one overlay per row,
+// followed by the report of every overlay with issues or warnings. With
+// logMode json all results are written as one JSON document. Tracked secrets
+// are masked.
+func writeValidationMatrix(w io.Writer, results []overlayResult) error {
+	w = trackedSecrets.writer(w)
+	if logMode == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		return encoder.Encode(results)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "OVERLAY\tRESULT")
+	for _, result := range results {
+		status := "pass"
+		switch {
+		case len(result.Error) > 0:
+			status = "error"
+		case !result.Valid:
+			status = fmt.Sprintf("fail (%d issue(s))", countErrors(result.Issues))
+		case len(result.Issues) > 0:
+			status = fmt.Sprintf("pass (%d warning(s))", len(result.Issues))
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", result.Overlay, status)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, result := range results {
+		if result.Valid && len(result.Issues) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "\n%s:\n", result.Overlay)
+		if len(result.Error) > 0 {
+			fmt.Fprintf(w, "  %s\n", result.Error)
+			continue
+		}
+		if err := writeValidationReport(w, result.Issues); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newValidateCmd returns the command validating data without rendering
+// templates.
+func newValidateCmd() *cobra.Command {
+	var all bool
+	validateCmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Validates the merged data without rendering templates",
+		Long: `Validates the merged data without rendering templates.
+
+Without flags the base merged with --overlaypath is validated. With --all the
+base is merged with every overlay below --overlaysdir in turn and a summary of
+all of them is printed. The command fails if any overlay fails validation.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if !all {
+				result := validateOverlays(overlayPaths...)
+				if len(result.Error) > 0 {
+					logger.Error("validation failed",
+						zap.String("error", result.Error),
+						zap.String("basePath", basePath),
+						zap.Strings("overlayPaths", overlayPaths),
+					)
+					os.Exit(1)
+				}
+				if err := writeValidationReport(cmd.OutOrStdout(), result.Issues); err != nil {
+					logger.Error("failed to write validation report",
+						zap.Error(err),
+					)
+				}
+				if !result.Valid {
+					os.Exit(1)
+				}
+				return
+			}
+
+			overlays, err := discoverOverlays(overlaysDir)
+			if err != nil {
+				logger.Error("failed to discover overlays",
+					zap.Error(err),
+					zap.String("overlaysDir", overlaysDir),
+				)
+				os.Exit(1)
+			}
+
+			failed := 0
+			results := make([]overlayResult, len(overlays))
+			for i, overlay := range overlays {
+				results[i] = validateOverlays(overlay)
+				if !results[i].Valid {
+					failed++
+				}
+			}
+
+			if err := writeValidationMatrix(cmd.OutOrStdout(), results); err != nil {
+				logger.Error("failed to write validation report",
+					zap.Error(err),
+				)
+			}
+			if failed > 0 {
+				logger.Error("validation failed",
+					zap.Int("failed", failed),
+					zap.Int("overlays", len(overlays)),
+				)
+				os.Exit(1)
+			}
+		},
+	}
+	validateCmd.Flags().BoolVar(&all, "all", false, "Validate the base merged with every overlay below --overlaysdir")
+	return validateCmd
+}
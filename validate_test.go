@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateOverlays(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "schema.cue"), "#Schema: {\n\tage: int & <=150\n\tname: string\n}\n")
+	writeTestFile(t, filepath.Join(dir, "base", "data.yaml"), "name: app\nage: 30\n")
+	writeTestFile(t, filepath.Join(dir, "overlays", "dev", "data.yaml"), "age: 40\n")
+	writeTestFile(t, filepath.Join(dir, "overlays", "prod", "data.yaml"), "age: 200\n")
+	writeTestFile(t, filepath.Join(dir, "overlays", "broken", "data.yaml"), "age: ${missing}\n")
+
+	defer func(previous string) { basePath = previous }(basePath)
+	defer func(previous string) { schemaPath = previous }(schemaPath)
+	basePath = filepath.Join(dir, "base")
+	schemaPath = filepath.Join(dir, "schema.cue")
+
+	dev := validateOverlays(filepath.Join(dir, "overlays", "dev"))
+	if !dev.Valid || len(dev.Issues) > 0 || len(dev.Error) > 0 {
+		t.Errorf("expected dev to pass, got %+v", dev)
+	}
+
+	prodPath := filepath.Join(dir, "overlays", "prod")
+	prod := validateOverlays(prodPath)
+	if prod.Valid || len(prod.Issues) != 1 {
+		t.Fatalf("expected prod to fail with one issue, got %+v", prod)
+	}
+	if prod.Issues[0].Path != "age" || prod.Issues[0].File != filepath.Join(prodPath, "data.yaml") {
+		t.Errorf("expected the issue at age from the prod overlay, got %+v", prod.Issues[0])
+	}
+
+	broken := validateOverlays(filepath.Join(dir, "overlays", "broken"))
+	if broken.Valid || !strings.Contains(broken.Error, "unknown reference ${missing}") {
+		t.Errorf("expected broken to fail with a reference error, got %+v", broken)
+	}
+}
+
+func TestWriteValidationMatrix(t *testing.T) {
+	defer func(previous string) { logMode = previous }(logMode)
+	results := []overlayResult{
+		{Overlay: "data/overlays/dev", Valid: true},
+		{Overlay: "data/overlays/prod", Issues: []validationIssue{{Path: "age", Message: "out of bound"}}},
+		{Overlay: "data/overlays/qa", Error: "error parsing data.yaml"},
+	}
+
+	logMode = "human"
+	var buf bytes.Buffer
+	if err := writeValidationMatrix(&buf, results); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := `OVERLAY              RESULT
+data/overlays/dev    pass
+data/overlays/prod   fail (1 issue(s))
+data/overlays/qa     error
+
+data/overlays/prod:
+validation failed with 1 issue(s):
+
+  age: out of bound
+
+data/overlays/qa:
+  error parsing data.yaml
+`
+	if buf.String() != expected {
+		t.Errorf("expected matrix:\n%s\ngot:\n%s", expected, buf.String())
+	}
+
+	logMode = "json"
+	buf.Reset()
+	if err := writeValidationMatrix(&buf, results); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var decoded []overlayResult
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("expected JSON output, got %v:\n%s", err, buf.String())
+	}
+	if len(decoded) != 3 || !decoded[0].Valid || decoded[1].Issues[0].Path != "age" || decoded[2].Error != "error parsing data.yaml" {
+		t.Errorf("unexpected JSON results: %+v", decoded)
+	}
+}
+
+func TestWriteValidationMatrix_Redacted(t *testing.T) {
+	defer func(previous string) { logMode = previous }(logMode)
+	defer func(tracker *secretTracker) { trackedSecrets = tracker }(trackedSecrets)
+	trackedSecrets = newSecretTracker()
+	trackedSecrets.track("hunter2")
+
+	results := []overlayResult{
+		{Overlay: "data/overlays/prod", Issues: []validationIssue{{Path: "password", Message: `invalid value "hunter2"`}}},
+		{Overlay: "data/overlays/qa", Error: `invalid value "hunter2"`},
+	}
+	for _, mode := range []string{"human", "json"} {
+		logMode = mode
+		var buf bytes.Buffer
+		if err := writeValidationMatrix(&buf, results); err != nil {
+			t.Fatalf("%s: unexpected error: %v", mode, err)
+		}
+		if strings.Contains(buf.String(), "hunter2") || !strings.Contains(buf.String(), redactedValue) {
+			t.Errorf("%s: expected the secret to be masked, got:\n%s", mode, buf.String())
+		}
+	}
+}
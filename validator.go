@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/santhosh-tekuri/jsonschema/v6/kind"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// validator validates merged data against a schema.
+type validator interface {
+	// validate returns the data templates should see, or a *validationError
+	// listing every violation.
+	validate(data Data) (Data, error)
+}
+
+// newValidator returns the validator for the schema at path, picked by its
+// extension: JSON Schema for .json files, CUE for everything else, including
+// the embedded schema used without a path.
+func newValidator(path string) validator {
+	if filepath.Ext(path) == ".json" {
+		return &jsonSchemaValidator{path: path}
+	}
+	return &cueValidator{path: path}
+}
+
+// cueValidator validates data against the #Schema definition of a CUE schema,
+// see loadSchema.
+type cueValidator struct {
+	path string
+}
+
+// validate unifies data with the schema and returns the concrete result, which
+// includes the defaults and computed fields of the schema.
+func (v *cueValidator) validate(data Data) (Data, error) {
+	ctx := cuecontext.New()
+	schema, err := loadSchema(ctx, v.path)
+	if err != nil {
+		return nil, err
+	}
+
+	dataAsCue := ctx.Encode(data)
+
+	unified := schema.Unify(dataAsCue)
+	err = unified.Validate(cue.Concrete(true))
+	if err != nil {
+		return nil, newValidationError(err, schema, data)
+	}
+
+	var validated Data
+	if err := unified.Decode(&validated); err != nil {
+		return nil, err
+	}
+	return validated, nil
+}
+
+// jsonSchemaValidator validates data against a JSON Schema. Schemas without
+// $schema are read as draft 2020-12. The data is returned unchanged.
+type jsonSchemaValidator struct {
+	path string
+	// documents caches the schema documents by URL, used to look up the
+	// failed constraints.
+	documents map[string]any
+}
+
+func (v *jsonSchemaValidator) validate(data Data) (Data, error) {
+	path, err := filepath.Abs(v.path)
+	if err != nil {
+		return nil, err
+	}
+
+	compiler := jsonschema.NewCompiler()
+	compiler.DefaultDraft(jsonschema.Draft2020)
+	schema, err := compiler.Compile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile schema %s: %w", v.path, err)
+	}
+
+	// Validate the JSON form of the data, as the schema describes JSON
+	content, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert data to JSON: %w", err)
+	}
+	instance, err := jsonschema.UnmarshalJSON(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert data to JSON: %w", err)
+	}
+
+	err = schema.Validate(instance)
+	if err == nil {
+		return data, nil
+	}
+	schemaErr, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		return nil, err
+	}
+
+	var issues []validationIssue
+	v.collectIssues(schemaErr, data, &issues)
+	return nil, &validationError{Issues: issues}
+}
+
+// jsonSchemaPrinter formats JSON Schema error messages.
+var jsonSchemaPrinter = message.NewPrinter(language.English)
+
+// collectIssues adds an issue for every leaf cause of err.
+func (v *jsonSchemaValidator) collectIssues(err *jsonschema.ValidationError, data Data, issues *[]validationIssue) {
+	if len(err.Causes) > 0 {
+		for _, cause := range err.Causes {
+			v.collectIssues(cause, data, issues)
+		}
+		return
+	}
+
+	constraint := v.constraint(err)
+
+	// Report missing properties at their own path
+	if required, ok := err.ErrorKind.(*kind.Required); ok {
+		for _, property := range required.Missing {
+			*issues = append(*issues, validationIssue{
+				Path:       joinPath(append(slices.Clip(err.InstanceLocation), property)),
+				Message:    "missing required property",
+				Constraint: constraint,
+			})
+		}
+		return
+	}
+
+	issue := validationIssue{
+		Path:       joinPath(err.InstanceLocation),
+		Message:    err.ErrorKind.LocalizedString(jsonSchemaPrinter),
+		Constraint: constraint,
+	}
+	if value, ok := valueAt(data, err.InstanceLocation); ok {
+		issue.Value = value
+	}
+	*issues = append(*issues, issue)
+}
+
+// constraint formats the failed keyword of err with its value in the schema,
+// e.g. "maximum: 150", falling back to the keyword location.
+func (v *jsonSchemaValidator) constraint(err *jsonschema.ValidationError) string {
+	keywordPath := err.ErrorKind.KeywordPath()
+	if len(keywordPath) == 0 {
+		return err.SchemaURL
+	}
+	location := err.SchemaURL + "/" + strings.Join(keywordPath, "/")
+
+	resource, fragment, _ := strings.Cut(err.SchemaURL, "#")
+	value, readErr := v.document(resource)
+	if readErr != nil {
+		return location
+	}
+
+	// Follow the JSON pointer of the schema location to the keyword
+	pointer := append(strings.Split(fragment, "/"), keywordPath...)
+	for _, token := range pointer {
+		if len(token) == 0 {
+			continue
+		}
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		object, ok := value.(map[string]any)
+		if !ok {
+			return location
+		}
+		if value, ok = object[token]; !ok {
+			return location
+		}
+	}
+	return fmt.Sprintf("%s: %s", keywordPath[len(keywordPath)-1], formatValue(value))
+}
+
+// document returns the parsed schema file behind a file:// URL.
+func (v *jsonSchemaValidator) document(resource string) (any, error) {
+	if document, ok := v.documents[resource]; ok {
+		return document, nil
+	}
+
+	u, err := url.Parse(resource)
+	if err != nil || u.Scheme != "file" {
+		return nil, fmt.Errorf("schema %s is not a local file", resource)
+	}
+	content, err := os.ReadFile(u.Path)
+	if err != nil {
+		return nil, err
+	}
+	document, err := jsonschema.UnmarshalJSON(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+
+	if v.documents == nil {
+		v.documents = make(map[string]any)
+	}
+	v.documents[resource] = document
+	return document, nil
+}
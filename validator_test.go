@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testJSONSchema = `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "type": "object",
+  "required": ["network"],
+  "properties": {
+    "age": {"type": "integer", "maximum": 150},
+    "passwords": {"type": "array", "items": {"type": "string"}},
+    "network": {"$ref": "#/$defs/network"}
+  },
+  "$defs": {
+    "network": {
+      "type": "object",
+      "required": ["cidr"],
+      "properties": {"cidr": {"type": "string"}}
+    }
+  }
+}`
+
+func TestNewValidator(t *testing.T) {
+	if _, ok := newValidator("schema/values.schema.json").(*jsonSchemaValidator); !ok {
+		t.Error("expected a JSON Schema validator for .json schemas")
+	}
+	for _, path := range []string{"", "schema.cue", "schema"} {
+		if _, ok := newValidator(path).(*cueValidator); !ok {
+			t.Errorf("expected a CUE validator for %q", path)
+		}
+	}
+}
+
+func TestJSONSchemaValidator(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "schema.json"), testJSONSchema)
+	v := newValidator(filepath.Join(dir, "schema.json"))
+
+	data := Data{"age": 120, "network": map[string]any{"cidr": "10.0.0.1/16"}}
+	validated, err := v.validate(data)
+	if err != nil {
+		t.Fatalf("validate returned error: %v", err)
+	}
+	if !reflect.DeepEqual(validated, data) {
+		t.Errorf("expected data to be returned unchanged, got %v", validated)
+	}
+}
+
+func TestJSONSchemaValidator_Issues(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "schema.json"), testJSONSchema)
+	v := newValidator(filepath.Join(dir, "schema.json"))
+
+	_, err := v.validate(Data{"age": 177, "passwords": []any{"$$secret$$", 1}, "network": map[string]any{}})
+
+	var validationErr *validationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected a *validationError, got %v", err)
+	}
+
+	expected := map[string]validationIssue{
+		"age":          {Path: "age", Message: "maximum: got 177, want 150", Constraint: "maximum: 150", Value: 177},
+		"passwords.1":  {Path: "passwords.1", Message: "got number, want string", Constraint: `type: "string"`, Value: 1},
+		"network.cidr": {Path: "network.cidr", Message: "missing required property", Constraint: `required: ["cidr"]`},
+	}
+	if len(validationErr.Issues) != len(expected) {
+		t.Fatalf("expected %d issues, got %v", len(expected), validationErr.Issues)
+	}
+	for _, issue := range validationErr.Issues {
+		if !reflect.DeepEqual(issue, expected[issue.Path]) {
+			t.Errorf("expected issue %v, got %v", expected[issue.Path], issue)
+		}
+	}
+}